@@ -3,6 +3,7 @@ package ast
 import (
 	"bytes"
 	"fmt"
+	"math/big"
 	"strings"
 
 	"github.com/karamaru-alpha/monkey/token"
@@ -11,6 +12,8 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position // ノードの先頭の位置
+	End() token.Position // ノードの直後の位置
 }
 
 type Statement interface {
@@ -25,6 +28,7 @@ type Expression interface {
 
 type Program struct {
 	Statements []Statement
+	Comments   []token.Token // lexer.WithCommentsを指定した場合のみ、出現順に格納される
 }
 
 func (p *Program) TokenLiteral() string {
@@ -34,6 +38,20 @@ func (p *Program) TokenLiteral() string {
 	return p.Statements[0].TokenLiteral()
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) == 0 {
+		return token.Position{Line: 1, Column: 1}
+	}
+	return p.Statements[0].Pos()
+}
+
+func (p *Program) End() token.Position {
+	if len(p.Statements) == 0 {
+		return p.Pos()
+	}
+	return p.Statements[len(p.Statements)-1].End()
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 	for _, statement := range p.Statements {
@@ -54,6 +72,14 @@ func (ls *LetStatement) TokenLiteral() string {
 	return ls.Token.Literal
 }
 
+func (ls *LetStatement) Pos() token.Position {
+	return ls.Token.Pos
+}
+
+func (ls *LetStatement) End() token.Position {
+	return ls.Value.End()
+}
+
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(ls.TokenLiteral() + " ")
@@ -77,6 +103,14 @@ func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
 
+func (i *Identifier) Pos() token.Position {
+	return i.Token.Pos
+}
+
+func (i *Identifier) End() token.Position {
+	return i.Token.End
+}
+
 func (i *Identifier) String() string {
 	return i.Value
 }
@@ -84,6 +118,7 @@ func (i *Identifier) String() string {
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
+	Big   *big.Int // Valueに収まらない場合のみ設定される
 }
 
 func (il *IntegerLiteral) expressionNode() {}
@@ -92,10 +127,41 @@ func (il *IntegerLiteral) TokenLiteral() string {
 	return il.Token.Literal
 }
 
+func (il *IntegerLiteral) Pos() token.Position {
+	return il.Token.Pos
+}
+
+func (il *IntegerLiteral) End() token.Position {
+	return il.Token.End
+}
+
 func (il *IntegerLiteral) String() string {
 	return il.Token.Literal
 }
 
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode() {}
+
+func (fl *FloatLiteral) TokenLiteral() string {
+	return fl.Token.Literal
+}
+
+func (fl *FloatLiteral) Pos() token.Position {
+	return fl.Token.Pos
+}
+
+func (fl *FloatLiteral) End() token.Position {
+	return fl.Token.End
+}
+
+func (fl *FloatLiteral) String() string {
+	return fl.Token.Literal
+}
+
 type StringLiteral struct {
 	Token token.Token
 	Value string
@@ -107,6 +173,14 @@ func (s *StringLiteral) TokenLiteral() string {
 	return s.Token.Literal
 }
 
+func (s *StringLiteral) Pos() token.Position {
+	return s.Token.Pos
+}
+
+func (s *StringLiteral) End() token.Position {
+	return s.Token.End
+}
+
 func (s *StringLiteral) String() string {
 	return s.Token.Literal
 }
@@ -122,6 +196,14 @@ func (b *Boolean) TokenLiteral() string {
 	return b.Token.Literal
 }
 
+func (b *Boolean) Pos() token.Position {
+	return b.Token.Pos
+}
+
+func (b *Boolean) End() token.Position {
+	return b.Token.End
+}
+
 func (b *Boolean) String() string {
 	return b.Token.Literal
 }
@@ -137,6 +219,17 @@ func (r *ReturnStatement) TokenLiteral() string {
 	return r.Token.Literal
 }
 
+func (r *ReturnStatement) Pos() token.Position {
+	return r.Token.Pos
+}
+
+func (r *ReturnStatement) End() token.Position {
+	if r.ReturnValue == nil {
+		return r.Token.End
+	}
+	return r.ReturnValue.End()
+}
+
 func (r *ReturnStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(r.TokenLiteral() + " ")
@@ -158,6 +251,14 @@ func (es *ExpressionStatement) TokenLiteral() string {
 	return es.Token.Literal
 }
 
+func (es *ExpressionStatement) Pos() token.Position {
+	return es.Token.Pos
+}
+
+func (es *ExpressionStatement) End() token.Position {
+	return es.Expression.End()
+}
+
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -177,6 +278,14 @@ func (pe *PrefixExpression) TokenLiteral() string {
 	return pe.Token.Literal
 }
 
+func (pe *PrefixExpression) Pos() token.Position {
+	return pe.Token.Pos
+}
+
+func (pe *PrefixExpression) End() token.Position {
+	return pe.Right.End()
+}
+
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -199,6 +308,14 @@ func (oe *InfixExpression) TokenLiteral() string {
 	return oe.Token.Literal
 }
 
+func (oe *InfixExpression) Pos() token.Position {
+	return oe.Left.Pos()
+}
+
+func (oe *InfixExpression) End() token.Position {
+	return oe.Right.End()
+}
+
 func (oe *InfixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -209,6 +326,37 @@ func (oe *InfixExpression) String() string {
 	return out.String()
 }
 
+// AssignExpression 定義済みの変数か、配列・ハッシュの要素に代入する。代入した値に評価される
+type AssignExpression struct {
+	Token  token.Token // =
+	Target Expression  // *Identifierか*IndexExpression
+	Value  Expression
+}
+
+func (ae *AssignExpression) expressionNode() {}
+
+func (ae *AssignExpression) TokenLiteral() string {
+	return ae.Token.Literal
+}
+
+func (ae *AssignExpression) Pos() token.Position {
+	return ae.Target.Pos()
+}
+
+func (ae *AssignExpression) End() token.Position {
+	return ae.Value.End()
+}
+
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" = ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+	return out.String()
+}
+
 type IfExpression struct {
 	Token       token.Token
 	Condition   Expression
@@ -222,6 +370,17 @@ func (ie *IfExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
 
+func (ie *IfExpression) Pos() token.Position {
+	return ie.Token.Pos
+}
+
+func (ie *IfExpression) End() token.Position {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+	return ie.Consequence.End()
+}
+
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("if")
@@ -236,8 +395,9 @@ func (ie *IfExpression) String() string {
 }
 
 type BlockStatement struct {
-	Token      token.Token
+	Token      token.Token // {
 	Statements []Statement
+	Rbrace     token.Token // }
 }
 
 func (b *BlockStatement) statementNode() {}
@@ -246,6 +406,14 @@ func (b *BlockStatement) TokenLiteral() string {
 	return b.Token.Literal
 }
 
+func (b *BlockStatement) Pos() token.Position {
+	return b.Token.Pos
+}
+
+func (b *BlockStatement) End() token.Position {
+	return b.Rbrace.End
+}
+
 func (b *BlockStatement) String() string {
 	var out bytes.Buffer
 	for _, s := range b.Statements {
@@ -258,6 +426,7 @@ type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
 	Body       *BlockStatement
+	Name       string // letで束縛された場合の名前
 }
 
 func (fl *FunctionLiteral) expressionNode() {}
@@ -266,6 +435,14 @@ func (fl *FunctionLiteral) TokenLiteral() string {
 	return fl.Token.Literal
 }
 
+func (fl *FunctionLiteral) Pos() token.Position {
+	return fl.Token.Pos
+}
+
+func (fl *FunctionLiteral) End() token.Position {
+	return fl.Body.End()
+}
+
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 	params := make([]string, 0)
@@ -273,6 +450,9 @@ func (fl *FunctionLiteral) String() string {
 		params = append(params, p.String())
 	}
 	out.WriteString(fl.TokenLiteral())
+	if fl.Name != "" {
+		out.WriteString(fmt.Sprintf("<%s>", fl.Name))
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") ")
@@ -281,9 +461,10 @@ func (fl *FunctionLiteral) String() string {
 }
 
 type CallExpression struct {
-	Token     token.Token
+	Token     token.Token // (
 	Function  Expression
 	Arguments []Expression
+	Rparen    token.Token // )
 }
 
 func (c *CallExpression) expressionNode() {}
@@ -292,6 +473,14 @@ func (c *CallExpression) TokenLiteral() string {
 	return c.Token.Literal
 }
 
+func (c *CallExpression) Pos() token.Position {
+	return c.Function.Pos()
+}
+
+func (c *CallExpression) End() token.Position {
+	return c.Rparen.End
+}
+
 func (c *CallExpression) String() string {
 	var out bytes.Buffer
 	args := make([]string, 0)
@@ -306,8 +495,9 @@ func (c *CallExpression) String() string {
 }
 
 type ArrayLiteral struct {
-	Token    token.Token
+	Token    token.Token // [
 	Elements []Expression
+	Rbracket token.Token // ]
 }
 
 func (a *ArrayLiteral) expressionNode() {}
@@ -316,6 +506,14 @@ func (a *ArrayLiteral) TokenLiteral() string {
 	return a.Token.Literal
 }
 
+func (a *ArrayLiteral) Pos() token.Position {
+	return a.Token.Pos
+}
+
+func (a *ArrayLiteral) End() token.Position {
+	return a.Rbracket.End
+}
+
 func (a *ArrayLiteral) String() string {
 	var out bytes.Buffer
 	elements := make([]string, 0)
@@ -329,8 +527,9 @@ func (a *ArrayLiteral) String() string {
 }
 
 type HashLiteral struct {
-	Token token.Token
-	Pairs map[Expression]Expression
+	Token  token.Token // {
+	Pairs  map[Expression]Expression
+	Rbrace token.Token // }
 }
 
 func (h *HashLiteral) expressionNode() {}
@@ -339,6 +538,14 @@ func (h *HashLiteral) TokenLiteral() string {
 	return h.Token.Literal
 }
 
+func (h *HashLiteral) Pos() token.Position {
+	return h.Token.Pos
+}
+
+func (h *HashLiteral) End() token.Position {
+	return h.Rbrace.End
+}
+
 func (h *HashLiteral) String() string {
 	var out bytes.Buffer
 	pairs := make([]string, 0, len(h.Pairs))
@@ -352,9 +559,10 @@ func (h *HashLiteral) String() string {
 }
 
 type IndexExpression struct {
-	Token token.Token
-	Left  Expression
-	Index Expression
+	Token    token.Token // [
+	Left     Expression
+	Index    Expression
+	Rbracket token.Token // ]
 }
 
 func (i *IndexExpression) expressionNode() {}
@@ -362,6 +570,15 @@ func (i *IndexExpression) expressionNode() {}
 func (i *IndexExpression) TokenLiteral() string {
 	return i.Token.Literal
 }
+
+func (i *IndexExpression) Pos() token.Position {
+	return i.Left.Pos()
+}
+
+func (i *IndexExpression) End() token.Position {
+	return i.Rbracket.End
+}
+
 func (i *IndexExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
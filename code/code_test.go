@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/karamaru-alpha/monkey/token"
 )
 
 func TestCode_String(t *testing.T) {
@@ -11,11 +13,15 @@ func TestCode_String(t *testing.T) {
 		Make(OpAdd),
 		Make(OpConstant, 2),
 		Make(OpConstant, 65535),
+		Make(OpGetLocal, 1),
+		Make(OpClosure, 65535, 255),
 	}
 
 	expected := `0000 OpAdd
 0001 OpConstant 2
 0004 OpConstant 65535
+0007 OpGetLocal 1
+0009 OpClosure 65535 255
 `
 
 	concatted := Instructions{}
@@ -33,6 +39,8 @@ func TestCode_Make(t *testing.T) {
 	}{
 		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
 		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
 	} {
 		assert.Equal(t, tt.expected, Make(tt.op, tt.operands...))
 	}
@@ -45,6 +53,8 @@ func TestCode_ReadOperands(t *testing.T) {
 		bytesRead int
 	}{
 		{OpConstant, []int{65535}, 2},
+		{OpGetLocal, []int{255}, 1},
+		{OpClosure, []int{65535, 255}, 3},
 	} {
 		instructions := Make(tt.op, tt.operands...)
 
@@ -56,3 +66,35 @@ func TestCode_ReadOperands(t *testing.T) {
 		assert.Equal(t, tt.operands, operandsRead)
 	}
 }
+
+func TestCostTable_Cost(t *testing.T) {
+	table := CostTable{OpCall: 10}
+	assert.Equal(t, uint64(10), table.Cost(OpCall))
+	assert.Equal(t, uint64(1), table.Cost(OpAdd))
+	assert.Equal(t, uint64(1), CostTable(nil).Cost(OpAdd))
+}
+
+func TestSourceMap_Lookup(t *testing.T) {
+	m := SourceMap{
+		{Offset: 0, Pos: token.Position{Line: 1, Column: 1}},
+		{Offset: 3, Pos: token.Position{Line: 1, Column: 5}},
+		{Offset: 6, Pos: token.Position{Line: 2, Column: 1}},
+	}
+	for _, tt := range []struct {
+		offset   int
+		expected token.Position
+	}{
+		{0, token.Position{Line: 1, Column: 1}},
+		{2, token.Position{Line: 1, Column: 1}},
+		{4, token.Position{Line: 1, Column: 5}},
+		{100, token.Position{Line: 2, Column: 1}},
+	} {
+		pos, ok := m.Lookup(tt.offset)
+		assert.True(t, ok)
+		assert.Equal(t, tt.expected, pos)
+	}
+
+	_, ok := SourceMap{}.Lookup(0)
+	assert.False(t, ok)
+	assert.Equal(t, m[:2], m.Truncate(6))
+}
@@ -0,0 +1,34 @@
+package code
+
+import (
+	"sort"
+
+	"github.com/karamaru-alpha/monkey/token"
+)
+
+// SourceMap 命令の位置とその命令を生成したソースコードの位置の対応。Offsetの昇順に並ぶ
+type SourceMap []SourceMapEntry
+
+type SourceMapEntry struct {
+	Offset int // Instructionsにおける命令の先頭の位置
+	Pos    token.Position
+}
+
+// Lookup offsetを含む命令のソースコード上の位置を返す。offsetはオペランドの途中を指していてもよい
+func (m SourceMap) Lookup(offset int) (token.Position, bool) {
+	i := sort.Search(len(m), func(i int) bool {
+		return m[i].Offset > offset
+	})
+	if i == 0 {
+		return token.Position{}, false
+	}
+	return m[i-1].Pos, true
+}
+
+// Truncate offset以降の命令の対応を取り除く
+func (m SourceMap) Truncate(offset int) SourceMap {
+	i := sort.Search(len(m), func(i int) bool {
+		return m[i].Offset >= offset
+	})
+	return m[:i]
+}
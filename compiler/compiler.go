@@ -7,6 +7,16 @@ import (
 	"github.com/karamaru-alpha/monkey/ast"
 	"github.com/karamaru-alpha/monkey/code"
 	"github.com/karamaru-alpha/monkey/object"
+	"github.com/karamaru-alpha/monkey/token"
+)
+
+const (
+	// MaxLocals OpGetLocalなどのoperandは1byteのため、関数ごとのローカル変数(引数を含む)の数には上限がある
+	MaxLocals = 256
+	// MaxArguments OpCallのoperandは1byteのため、1回の呼び出しで渡せる引数の数には上限がある
+	MaxArguments = 255
+	// MaxFreeVariables OpClosureの捕捉する変数の数のoperandは1byteのため、関数ごとの自由変数の数には上限がある
+	MaxFreeVariables = 255
 )
 
 type Compiler struct {
@@ -14,15 +24,18 @@ type Compiler struct {
 	symbolTable *SymbolTable
 	scopes      []CompilationScope
 	scopeIndex  int
+	position    token.Position // コンパイル中のノードの位置
 }
 
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	SourceMap    code.SourceMap
 }
 
 type CompilationScope struct {
 	instructions        code.Instructions
+	sourceMap           code.SourceMap
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
 }
@@ -38,9 +51,13 @@ func New() *Compiler {
 		lastInstruction:     EmittedInstruction{},
 		previousInstruction: EmittedInstruction{},
 	}
+	symbolTable := NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
 	return &Compiler{
 		constants:   []object.Object{},
-		symbolTable: NewSymbolTable(),
+		symbolTable: symbolTable,
 		scopes:      []CompilationScope{mainScope},
 		scopeIndex:  0,
 	}
@@ -54,6 +71,14 @@ func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
 }
 
 func (c *Compiler) Compile(node ast.Node) error {
+	if node == nil {
+		return nil
+	}
+	// 生成した命令には、それを生成したノードの位置を対応させる
+	outer := c.position
+	c.position = node.Pos()
+	defer func() { c.position = outer }()
+
 	switch node := node.(type) {
 	case *ast.Program:
 		for _, s := range node.Statements {
@@ -73,15 +98,11 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpPop)
 	case *ast.InfixExpression:
-		if node.Operator == "<" {
-			if err := c.Compile(node.Right); err != nil {
-				return err
-			}
-			if err := c.Compile(node.Left); err != nil {
-				return err
-			}
-			c.emit(code.OpGreaterThan)
-			return nil
+		switch node.Operator {
+		case "&&":
+			return c.compileAnd(node)
+		case "||":
+			return c.compileOr(node)
 		}
 
 		if err := c.Compile(node.Left); err != nil {
@@ -99,12 +120,32 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpMul)
 		case "/":
 			c.emit(code.OpDiv)
+		case "%":
+			c.emit(code.OpMod)
+		case "**":
+			c.emit(code.OpPow)
 		case "==":
 			c.emit(code.OpEqual)
 		case "!=":
 			c.emit(code.OpNotEqual)
 		case ">":
 			c.emit(code.OpGreaterThan)
+		case ">=":
+			c.emit(code.OpGreaterThanOrEqual)
+		case "<":
+			c.emit(code.OpLessThan)
+		case "<=":
+			c.emit(code.OpLessThanOrEqual)
+		case "&":
+			c.emit(code.OpBitAnd)
+		case "|":
+			c.emit(code.OpBitOr)
+		case "^":
+			c.emit(code.OpBitXor)
+		case "<<":
+			c.emit(code.OpShiftLeft)
+		case ">>":
+			c.emit(code.OpShiftRight)
 		default:
 			return fmt.Errorf("unknown operator %s", node.Operator)
 		}
@@ -117,12 +158,20 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpBang)
 		case "-":
 			c.emit(code.OpMinus)
+		case "~":
+			c.emit(code.OpBitNot)
 		default:
 			return fmt.Errorf("unknown operator %s", node.Operator)
 		}
 	case *ast.IntegerLiteral:
-		integer := &object.Integer{Value: node.Value}
+		var integer object.Object = &object.Integer{Value: node.Value}
+		if node.Big != nil {
+			integer = &object.BigInt{Value: node.Big}
+		}
 		c.emit(code.OpConstant, c.addConstant(integer))
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
 	case *ast.StringLiteral:
 		str := &object.String{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(str))
@@ -169,13 +218,24 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if !ok {
 			return fmt.Errorf("undefined variable %s", node.Value)
 		}
-		c.emit(code.OpGetGlobal, symbol.Index)
+		c.loadSymbol(symbol)
 	case *ast.LetStatement:
+		// 関数は自身の名前を参照できるよう先に定義する。再帰呼び出しは代入と同じく定義したスコープの変数を通す
+		var symbol Symbol
+		if _, ok := node.Value.(*ast.FunctionLiteral); ok {
+			symbol = c.symbolTable.Define(node.Name.Value)
+		}
 		if err := c.Compile(node.Value); err != nil {
 			return err
 		}
-		symbol := c.symbolTable.Define(node.Name.Value)
-		c.emit(code.OpSetGlobal, symbol.Index)
+		if symbol.Name == "" {
+			symbol = c.symbolTable.Define(node.Name.Value)
+		}
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpSetGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
 	case *ast.ArrayLiteral:
 		for _, e := range node.Elements {
 			if err := c.Compile(e); err != nil {
@@ -210,6 +270,9 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.emit(code.OpIndex)
 	case *ast.FunctionLiteral:
 		c.enterScope()
+		for _, p := range node.Parameters {
+			c.symbolTable.Define(p.Value)
+		}
 		if err := c.Compile(node.Body); err != nil {
 			return err
 		}
@@ -217,22 +280,100 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.replaceLastPopWithReturn()
 		}
 		if !c.lastInstructionIs(code.OpReturn) {
+			c.emit(code.OpNull)
 			c.emit(code.OpReturn)
 		}
-		ins := c.leaveScope()
-		compiledFn := &object.CompiledFunction{Instructions: ins}
-		c.emit(code.OpConstant, c.addConstant(compiledFn))
+		freeSymbols := c.symbolTable.FreeSymbols
+		numLocals := c.symbolTable.numDefinitions
+		if numLocals > MaxLocals {
+			return fmt.Errorf("too many local variables. max: %d", MaxLocals)
+		}
+		if len(freeSymbols) > MaxFreeVariables {
+			return fmt.Errorf("too many free variables. max: %d", MaxFreeVariables)
+		}
+		ins, sourceMap := c.leaveScope()
+
+		// 捕捉する変数を外側のスコープで積んでからクロージャを生成する
+		for _, s := range freeSymbols {
+			c.captureSymbol(s)
+		}
+		compiledFn := &object.CompiledFunction{
+			Instructions:  ins,
+			NumLocals:     numLocals,
+			NumParameters: len(node.Parameters),
+			Name:          node.Name,
+			SourceMap:     sourceMap,
+		}
+		c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+	case *ast.AssignExpression:
+		return c.compileAssign(node)
 	case *ast.ReturnStatement:
 		if err := c.Compile(node.ReturnValue); err != nil {
 			return err
 		}
 		c.emit(code.OpReturn)
 	case *ast.CallExpression:
+		if len(node.Arguments) > MaxArguments {
+			return fmt.Errorf("too many arguments. max: %d", MaxArguments)
+		}
 		if err := c.Compile(node.Function); err != nil {
 			return err
 		}
-		c.emit(code.OpCall)
+		for _, arg := range node.Arguments {
+			if err := c.Compile(arg); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpCall, len(node.Arguments))
+	}
+	return nil
+}
+
+// compileAnd 左辺が偽であれば右辺を評価せずにfalseになる。結果は常に真偽値
+func (c *Compiler) compileAnd(node *ast.InfixExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+	leftFalsyPosition := c.emit(code.OpJumpNotTruthy)
+	if err := c.Compile(node.Right); err != nil {
+		return err
+	}
+	rightFalsyPosition := c.emit(code.OpJumpNotTruthy)
+	c.emit(code.OpTrue)
+	jumpPosition := c.emit(code.OpJump)
+
+	falsePosition := len(c.currentInstructions())
+	c.changeOperand(leftFalsyPosition, falsePosition)
+	c.changeOperand(rightFalsyPosition, falsePosition)
+	c.emit(code.OpFalse)
+
+	c.changeOperand(jumpPosition, len(c.currentInstructions()))
+	return nil
+}
+
+// compileOr 左辺が真であれば右辺を評価せずにtrueになる。結果は常に真偽値
+func (c *Compiler) compileOr(node *ast.InfixExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
 	}
+	leftFalsyPosition := c.emit(code.OpJumpNotTruthy)
+	c.emit(code.OpTrue)
+	leftJumpPosition := c.emit(code.OpJump)
+
+	c.changeOperand(leftFalsyPosition, len(c.currentInstructions()))
+	if err := c.Compile(node.Right); err != nil {
+		return err
+	}
+	rightFalsyPosition := c.emit(code.OpJumpNotTruthy)
+	c.emit(code.OpTrue)
+	rightJumpPosition := c.emit(code.OpJump)
+
+	c.changeOperand(rightFalsyPosition, len(c.currentInstructions()))
+	c.emit(code.OpFalse)
+
+	afterPosition := len(c.currentInstructions())
+	c.changeOperand(leftJumpPosition, afterPosition)
+	c.changeOperand(rightJumpPosition, afterPosition)
 	return nil
 }
 
@@ -259,6 +400,7 @@ func (c *Compiler) addInstruction(ins []byte) int {
 	position := len(c.currentInstructions())
 	instructions := append(c.currentInstructions(), ins...)
 	c.scopes[c.scopeIndex].instructions = instructions
+	c.scopes[c.scopeIndex].sourceMap = append(c.scopes[c.scopeIndex].sourceMap, code.SourceMapEntry{Offset: position, Pos: c.position})
 	return position
 }
 
@@ -270,6 +412,7 @@ func (c *Compiler) removeLastPop() {
 	new := old[:last.Position]
 
 	c.scopes[c.scopeIndex].instructions = new
+	c.scopes[c.scopeIndex].sourceMap = c.scopes[c.scopeIndex].sourceMap.Truncate(last.Position)
 	c.scopes[c.scopeIndex].lastInstruction = pre
 }
 
@@ -298,13 +441,81 @@ func (c *Compiler) enterScope() {
 	}
 	c.scopes = append(c.scopes, scope)
 	c.scopeIndex++
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
 }
 
-func (c *Compiler) leaveScope() code.Instructions {
+func (c *Compiler) leaveScope() (code.Instructions, code.SourceMap) {
 	ins := c.currentInstructions()
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
 	c.scopes = c.scopes[:len(c.scopes)-1]
 	c.scopeIndex--
-	return ins
+	c.symbolTable = c.symbolTable.Outer
+	return ins, sourceMap
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	}
+}
+
+// captureSymbol 捕捉した関数と外側の関数で代入を共有するため、ローカル変数と自由変数は値ではなく変数そのものを積む
+func (c *Compiler) captureSymbol(s Symbol) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(code.OpCaptureLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpCaptureFree, s.Index)
+	default:
+		c.loadSymbol(s)
+	}
+}
+
+// compileAssign 代入した値をスタックに残す
+func (c *Compiler) compileAssign(node *ast.AssignExpression) error {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(target.Value)
+		if !ok {
+			return fmt.Errorf("undefined variable %s", target.Value)
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		switch symbol.Scope {
+		case GlobalScope:
+			c.emit(code.OpSetGlobal, symbol.Index)
+		case LocalScope:
+			c.emit(code.OpSetLocal, symbol.Index)
+		case FreeScope:
+			c.emit(code.OpSetFree, symbol.Index)
+		default:
+			// builtin関数
+			return fmt.Errorf("cannot assign to %s", target.Value)
+		}
+		c.loadSymbol(symbol)
+	case *ast.IndexExpression:
+		if err := c.Compile(target.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(target.Index); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpSetIndex)
+	default:
+		return fmt.Errorf("cannot assign to %s", node.Target)
+	}
+	return nil
 }
 
 func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
@@ -324,5 +535,6 @@ func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.currentInstructions(),
 		Constants:    c.constants,
+		SourceMap:    c.scopes[c.scopeIndex].sourceMap,
 	}
 }
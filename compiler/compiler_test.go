@@ -1,6 +1,8 @@
 package compiler
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -68,6 +70,163 @@ func TestCompiler_Compile(t *testing.T) {
 				},
 			},
 		},
+		{
+			input: "5 % 2 ** 3",
+			expected: expected{
+				constants: []interface{}{5, 2, 3},
+				instructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpPow),
+					code.Make(code.OpMod),
+					code.Make(code.OpPop),
+				},
+			},
+		},
+		{
+			input: "~1 & 2 | 3 ^ 4 << 5 >> 6",
+			expected: expected{
+				constants: []interface{}{1, 2, 3, 4, 5, 6},
+				instructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpBitNot),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpBitAnd),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpConstant, 3),
+					code.Make(code.OpConstant, 4),
+					code.Make(code.OpShiftLeft),
+					code.Make(code.OpConstant, 5),
+					code.Make(code.OpShiftRight),
+					code.Make(code.OpBitXor),
+					code.Make(code.OpBitOr),
+					code.Make(code.OpPop),
+				},
+			},
+		},
+		{
+			input: "let x = 1; x = 2",
+			expected: expected{
+				constants: []interface{}{1, 2},
+				instructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetGlobal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpSetGlobal, 0),
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpPop),
+				},
+			},
+		},
+		{
+			input: "let arr = [1]; arr[0] = 2",
+			expected: expected{
+				constants: []interface{}{1, 0, 2},
+				instructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpArray, 1),
+					code.Make(code.OpSetGlobal, 0),
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpSetIndex),
+					code.Make(code.OpPop),
+				},
+			},
+		},
+		{
+			input: "fn(a) { a = 1; fn() { a = 2 } }",
+			expected: expected{
+				constants: []interface{}{
+					1,
+					2,
+					[]code.Instructions{
+						code.Make(code.OpConstant, 1),
+						code.Make(code.OpSetFree, 0),
+						code.Make(code.OpGetFree, 0),
+						code.Make(code.OpReturn),
+					},
+					[]code.Instructions{
+						code.Make(code.OpConstant, 0),
+						code.Make(code.OpSetLocal, 0),
+						code.Make(code.OpGetLocal, 0),
+						code.Make(code.OpPop),
+						code.Make(code.OpCaptureLocal, 0),
+						code.Make(code.OpClosure, 2, 1),
+						code.Make(code.OpReturn),
+					},
+				},
+				instructions: []code.Instructions{
+					code.Make(code.OpClosure, 3, 0),
+					code.Make(code.OpPop),
+				},
+			},
+		},
+		{
+			input: "1 <= 2",
+			expected: expected{
+				constants: []interface{}{1, 2},
+				instructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpLessThanOrEqual),
+					code.Make(code.OpPop),
+				},
+			},
+		},
+		{
+			input: "true && false",
+			expected: expected{
+				constants: []interface{}{},
+				instructions: []code.Instructions{
+					// 0000
+					code.Make(code.OpTrue),
+					// 0001
+					code.Make(code.OpJumpNotTruthy, 12),
+					// 0004
+					code.Make(code.OpFalse),
+					// 0005
+					code.Make(code.OpJumpNotTruthy, 12),
+					// 0008
+					code.Make(code.OpTrue),
+					// 0009
+					code.Make(code.OpJump, 13),
+					// 0012
+					code.Make(code.OpFalse),
+					// 0013
+					code.Make(code.OpPop),
+				},
+			},
+		},
+		{
+			input: "true || false",
+			expected: expected{
+				constants: []interface{}{},
+				instructions: []code.Instructions{
+					// 0000
+					code.Make(code.OpTrue),
+					// 0001
+					code.Make(code.OpJumpNotTruthy, 8),
+					// 0004
+					code.Make(code.OpTrue),
+					// 0005
+					code.Make(code.OpJump, 17),
+					// 0008
+					code.Make(code.OpFalse),
+					// 0009
+					code.Make(code.OpJumpNotTruthy, 16),
+					// 0012
+					code.Make(code.OpTrue),
+					// 0013
+					code.Make(code.OpJump, 17),
+					// 0016
+					code.Make(code.OpFalse),
+					// 0017
+					code.Make(code.OpPop),
+				},
+			},
+		},
 		{
 			input: "true",
 			expected: expected{
@@ -127,11 +286,11 @@ func TestCompiler_Compile(t *testing.T) {
 		{
 			input: "2 < 1",
 			expected: expected{
-				constants: []interface{}{1, 2},
+				constants: []interface{}{2, 1},
 				instructions: []code.Instructions{
 					code.Make(code.OpConstant, 0),
 					code.Make(code.OpConstant, 1),
-					code.Make(code.OpGreaterThan),
+					code.Make(code.OpLessThan),
 					code.Make(code.OpPop),
 				},
 			},
@@ -318,7 +477,7 @@ func TestCompiler_Compile(t *testing.T) {
 					},
 				},
 				instructions: []code.Instructions{
-					code.Make(code.OpConstant, 2),
+					code.Make(code.OpClosure, 2, 0),
 					code.Make(code.OpPop),
 				},
 			},
@@ -337,7 +496,7 @@ func TestCompiler_Compile(t *testing.T) {
 					},
 				},
 				instructions: []code.Instructions{
-					code.Make(code.OpConstant, 2),
+					code.Make(code.OpClosure, 2, 0),
 					code.Make(code.OpPop),
 				},
 			},
@@ -353,8 +512,8 @@ func TestCompiler_Compile(t *testing.T) {
 					},
 				},
 				instructions: []code.Instructions{
-					code.Make(code.OpConstant, 1),
-					code.Make(code.OpCall),
+					code.Make(code.OpClosure, 1, 0),
+					code.Make(code.OpCall, 0),
 					code.Make(code.OpPop),
 				},
 			},
@@ -370,10 +529,219 @@ func TestCompiler_Compile(t *testing.T) {
 					},
 				},
 				instructions: []code.Instructions{
+					code.Make(code.OpClosure, 1, 0),
+					code.Make(code.OpSetGlobal, 0),
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpPop),
+				},
+			},
+		},
+		{
+			input: "fn() { }",
+			expected: expected{
+				constants: []interface{}{
+					[]code.Instructions{
+						code.Make(code.OpNull),
+						code.Make(code.OpReturn),
+					},
+				},
+				instructions: []code.Instructions{
+					code.Make(code.OpClosure, 0, 0),
+					code.Make(code.OpPop),
+				},
+			},
+		},
+		{
+			input: "let num = 1; fn() { num }",
+			expected: expected{
+				constants: []interface{}{
+					1,
+					[]code.Instructions{
+						code.Make(code.OpGetGlobal, 0),
+						code.Make(code.OpReturn),
+					},
+				},
+				instructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetGlobal, 0),
+					code.Make(code.OpClosure, 1, 0),
+					code.Make(code.OpPop),
+				},
+			},
+		},
+		{
+			input: "fn() { let num = 1; num }",
+			expected: expected{
+				constants: []interface{}{
+					1,
+					[]code.Instructions{
+						code.Make(code.OpConstant, 0),
+						code.Make(code.OpSetLocal, 0),
+						code.Make(code.OpGetLocal, 0),
+						code.Make(code.OpReturn),
+					},
+				},
+				instructions: []code.Instructions{
+					code.Make(code.OpClosure, 1, 0),
+					code.Make(code.OpPop),
+				},
+			},
+		},
+		{
+			input: "let hoge = fn(a, b) { a + b }; hoge(1, 2)",
+			expected: expected{
+				constants: []interface{}{
+					[]code.Instructions{
+						code.Make(code.OpGetLocal, 0),
+						code.Make(code.OpGetLocal, 1),
+						code.Make(code.OpAdd),
+						code.Make(code.OpReturn),
+					},
+					1,
+					2,
+				},
+				instructions: []code.Instructions{
+					code.Make(code.OpClosure, 0, 0),
+					code.Make(code.OpSetGlobal, 0),
+					code.Make(code.OpGetGlobal, 0),
 					code.Make(code.OpConstant, 1),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpCall, 2),
+					code.Make(code.OpPop),
+				},
+			},
+		},
+		{
+			input: "fn(a) { fn(b) { a + b } }",
+			expected: expected{
+				constants: []interface{}{
+					[]code.Instructions{
+						code.Make(code.OpGetFree, 0),
+						code.Make(code.OpGetLocal, 0),
+						code.Make(code.OpAdd),
+						code.Make(code.OpReturn),
+					},
+					[]code.Instructions{
+						code.Make(code.OpCaptureLocal, 0),
+						code.Make(code.OpClosure, 0, 1),
+						code.Make(code.OpReturn),
+					},
+				},
+				instructions: []code.Instructions{
+					code.Make(code.OpClosure, 1, 0),
+					code.Make(code.OpPop),
+				},
+			},
+		},
+		{
+			input: "fn(a) { fn(b) { fn(c) { a + b + c } } }",
+			expected: expected{
+				constants: []interface{}{
+					[]code.Instructions{
+						code.Make(code.OpGetFree, 0),
+						code.Make(code.OpGetFree, 1),
+						code.Make(code.OpAdd),
+						code.Make(code.OpGetLocal, 0),
+						code.Make(code.OpAdd),
+						code.Make(code.OpReturn),
+					},
+					[]code.Instructions{
+						code.Make(code.OpCaptureFree, 0),
+						code.Make(code.OpCaptureLocal, 0),
+						code.Make(code.OpClosure, 0, 2),
+						code.Make(code.OpReturn),
+					},
+					[]code.Instructions{
+						code.Make(code.OpCaptureLocal, 0),
+						code.Make(code.OpClosure, 1, 1),
+						code.Make(code.OpReturn),
+					},
+				},
+				instructions: []code.Instructions{
+					code.Make(code.OpClosure, 2, 0),
+					code.Make(code.OpPop),
+				},
+			},
+		},
+		{
+			input: "let countDown = fn(x) { countDown(x - 1) }; countDown(1)",
+			expected: expected{
+				constants: []interface{}{
+					1,
+					[]code.Instructions{
+						code.Make(code.OpGetGlobal, 0),
+						code.Make(code.OpGetLocal, 0),
+						code.Make(code.OpConstant, 0),
+						code.Make(code.OpSub),
+						code.Make(code.OpCall, 1),
+						code.Make(code.OpReturn),
+					},
+					1,
+				},
+				instructions: []code.Instructions{
+					code.Make(code.OpClosure, 1, 0),
 					code.Make(code.OpSetGlobal, 0),
 					code.Make(code.OpGetGlobal, 0),
-					code.Make(code.OpCall),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpPop),
+				},
+			},
+		},
+		{
+			input: "fn() { let f = fn() { f() }; f() }",
+			expected: expected{
+				constants: []interface{}{
+					[]code.Instructions{
+						code.Make(code.OpGetFree, 0),
+						code.Make(code.OpCall, 0),
+						code.Make(code.OpReturn),
+					},
+					[]code.Instructions{
+						code.Make(code.OpCaptureLocal, 0),
+						code.Make(code.OpClosure, 0, 1),
+						code.Make(code.OpSetLocal, 0),
+						code.Make(code.OpGetLocal, 0),
+						code.Make(code.OpCall, 0),
+						code.Make(code.OpReturn),
+					},
+				},
+				instructions: []code.Instructions{
+					code.Make(code.OpClosure, 1, 0),
+					code.Make(code.OpPop),
+				},
+			},
+		},
+		{
+			input: "len([]); puts(1)",
+			expected: expected{
+				constants: []interface{}{1},
+				instructions: []code.Instructions{
+					code.Make(code.OpGetBuiltin, 0),
+					code.Make(code.OpArray, 0),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpPop),
+					code.Make(code.OpGetBuiltin, 1),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpPop),
+				},
+			},
+		},
+		{
+			input: "fn() { len([]) }",
+			expected: expected{
+				constants: []interface{}{
+					[]code.Instructions{
+						code.Make(code.OpGetBuiltin, 0),
+						code.Make(code.OpArray, 0),
+						code.Make(code.OpCall, 1),
+						code.Make(code.OpReturn),
+					},
+				},
+				instructions: []code.Instructions{
+					code.Make(code.OpClosure, 0, 0),
 					code.Make(code.OpPop),
 				},
 			},
@@ -398,6 +766,12 @@ func testConstants(t *testing.T, expected []interface{}, actual []object.Object)
 		case int:
 			result := actual[i].(*object.Integer)
 			assert.Equal(t, int64(constant), result.Value)
+		case string:
+			result := actual[i].(*object.String)
+			assert.Equal(t, constant, result.Value)
+		case []code.Instructions:
+			result := actual[i].(*object.CompiledFunction)
+			assert.Equal(t, concatInstructions(constant), result.Instructions)
 		}
 	}
 }
@@ -409,3 +783,77 @@ func concatInstructions(s []code.Instructions) code.Instructions {
 	}
 	return out
 }
+
+func TestCompiler_AssignError(t *testing.T) {
+	for _, tt := range []struct {
+		input    string
+		expected string
+	}{
+		{"x = 1", "undefined variable x"},
+		{"len = 1", "cannot assign to len"},
+	} {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+
+		symbolTable := NewSymbolTable()
+		symbolTable.DefineBuiltin(0, "len")
+		compiler := NewWithState(symbolTable, []object.Object{})
+		assert.EqualError(t, compiler.Compile(program), tt.expected, tt.input)
+	}
+}
+
+func TestCompiler_Limits(t *testing.T) {
+	// locals n個のローカル変数を定義して最初の変数を返す関数
+	locals := func(n int) string {
+		var b strings.Builder
+		b.WriteString("fn() { ")
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(&b, "let a%d = %d; ", i, i)
+		}
+		b.WriteString("a0 }")
+		return b.String()
+	}
+	// params n個の引数を受け取る関数
+	params := func(n int) string {
+		names := make([]string, n)
+		for i := range names {
+			names[i] = fmt.Sprintf("p%d", i)
+		}
+		return fmt.Sprintf("fn(%s) { p0 }", strings.Join(names, ", "))
+	}
+	// frees n個の外側の変数を捕捉する関数
+	frees := func(n int) string {
+		names := make([]string, n)
+		for i := range names {
+			names[i] = fmt.Sprintf("p%d", i)
+		}
+		list := strings.Join(names, ", ")
+		return fmt.Sprintf("fn(%s) { fn() { [%s] } }", list, list)
+	}
+	// args n個の引数で関数を呼び出す
+	args := func(n int) string {
+		return fmt.Sprintf("let f = fn() {}; f(%s)", strings.TrimSuffix(strings.Repeat("1, ", n), ", "))
+	}
+
+	for _, tt := range []struct {
+		input    string
+		expected string
+	}{
+		{locals(MaxLocals), ""},
+		{locals(MaxLocals + 1), "too many local variables. max: 256"},
+		{params(MaxLocals), ""},
+		{params(MaxLocals + 1), "too many local variables. max: 256"},
+		{args(MaxArguments), ""},
+		{args(MaxArguments + 1), "too many arguments. max: 255"},
+		{frees(MaxFreeVariables), ""},
+		{frees(MaxFreeVariables + 1), "too many free variables. max: 255"},
+	} {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+
+		err := New().Compile(program)
+		if tt.expected == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, tt.expected)
+		}
+	}
+}
@@ -2,7 +2,12 @@ package compiler
 
 type SymbolScope string
 
-const GlobalScope SymbolScope = "GLOBAL"
+const (
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	FreeScope    SymbolScope = "FREE"
+	BuiltinScope SymbolScope = "BUILTIN"
+)
 
 type Symbol struct {
 	Name  string
@@ -11,6 +16,9 @@ type Symbol struct {
 }
 
 type SymbolTable struct {
+	Outer       *SymbolTable
+	FreeSymbols []Symbol // 外側の関数から捕捉した変数(外側のスコープでのSymbol)
+
 	store          map[string]Symbol
 	numDefinitions int
 }
@@ -22,18 +30,55 @@ func NewSymbolTable() *SymbolTable {
 	}
 }
 
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
 func (s *SymbolTable) Define(name string) Symbol {
 	symbol := Symbol{
 		Name:  name,
 		Index: s.numDefinitions,
-		Scope: GlobalScope,
+	}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	} else {
+		symbol.Scope = LocalScope
 	}
 	s.store[name] = symbol
 	s.numDefinitions++
 	return symbol
 }
 
+// DefineBuiltin indexはobject.Builtinsの位置
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Scope: BuiltinScope, Index: index}
+	s.store[name] = symbol
+	return symbol
+}
+
 func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	obj, ok := s.store[name]
-	return obj, ok
+	if ok || s.Outer == nil {
+		return obj, ok
+	}
+
+	obj, ok = s.Outer.Resolve(name)
+	if !ok || obj.Scope == GlobalScope || obj.Scope == BuiltinScope {
+		return obj, ok
+	}
+	return s.defineFree(obj), true
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{
+		Name:  original.Name,
+		Scope: FreeScope,
+		Index: len(s.FreeSymbols) - 1,
+	}
+	s.store[original.Name] = symbol
+	return symbol
 }
@@ -57,3 +57,67 @@ func TestSymbolTable_Resolve(t *testing.T) {
 		assert.Equal(t, tt.expected.symbol, symbol)
 	}
 }
+
+func TestSymbolTable_ResolveLocal(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	local := NewEnclosedSymbolTable(global)
+	local.Define("b")
+	nested := NewEnclosedSymbolTable(local)
+	nested.Define("c")
+
+	for _, tt := range []struct {
+		table    *SymbolTable
+		name     string
+		expected Symbol
+	}{
+		{local, "a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{local, "b", Symbol{Name: "b", Scope: LocalScope, Index: 0}},
+		{nested, "a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{nested, "c", Symbol{Name: "c", Scope: LocalScope, Index: 0}},
+	} {
+		symbol, ok := tt.table.Resolve(tt.name)
+		assert.True(t, ok)
+		assert.Equal(t, tt.expected, symbol)
+	}
+}
+
+func TestSymbolTable_ResolveFree(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	first := NewEnclosedSymbolTable(global)
+	first.Define("b")
+	second := NewEnclosedSymbolTable(first)
+	second.Define("c")
+
+	for _, tt := range []struct {
+		name     string
+		expected Symbol
+	}{
+		{"a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{"b", Symbol{Name: "b", Scope: FreeScope, Index: 0}},
+		{"c", Symbol{Name: "c", Scope: LocalScope, Index: 0}},
+	} {
+		symbol, ok := second.Resolve(tt.name)
+		assert.True(t, ok)
+		assert.Equal(t, tt.expected, symbol)
+	}
+	assert.Equal(t, []Symbol{{Name: "b", Scope: LocalScope, Index: 0}}, second.FreeSymbols)
+
+	_, ok := second.Resolve("d")
+	assert.False(t, ok)
+}
+
+func TestSymbolTable_DefineBuiltin(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+	local := NewEnclosedSymbolTable(NewEnclosedSymbolTable(global))
+
+	expected := Symbol{Name: "len", Scope: BuiltinScope, Index: 0}
+	for _, table := range []*SymbolTable{global, local} {
+		symbol, ok := table.Resolve("len")
+		assert.True(t, ok)
+		assert.Equal(t, expected, symbol)
+	}
+	assert.Empty(t, local.FreeSymbols)
+}
@@ -1,6 +1,7 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/karamaru-alpha/monkey/ast"
@@ -8,53 +9,75 @@ import (
 )
 
 var (
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
-	NULL  = &object.Null{}
+	TRUE  = object.TrueObject
+	FALSE = object.FalseObject
+	NULL  = object.NullObject
 )
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return eval(context.Background(), node, env)
+}
+
+// EvalContext ctxがキャンセルされると評価を中断し、object.ErrCanceledを満たすエラーを返す。
+// スクリプト内で発生したエラーはEvalと同様に*object.Errorとして返す
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment) (object.Object, error) {
+	result := eval(ctx, node, env)
+	if err := ctx.Err(); err != nil && isError(result) {
+		return nil, &object.CanceledError{Err: err}
+	}
+	return result, nil
+}
+
+func eval(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
-		return evalProgram(node, env)
+		return evalProgram(ctx, node, env)
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return eval(ctx, node.Expression, env)
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return &object.BigInt{Value: node.Big}
+		}
 		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 	case *ast.Boolean:
 		return toBooleanObject(node.Value)
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := eval(ctx, node.Right, env)
 		if isError(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(ctx, node, env)
+		}
+		left := eval(ctx, node.Left, env)
 		if isError(left) {
 			return left
 		}
-		right := Eval(node.Right, env)
+		right := eval(ctx, node.Right, env)
 		if isError(right) {
 			return right
 		}
 		return evalInfixExpression(node.Operator, left, right)
 	case *ast.BlockStatement:
-		return evalBlockStatements(node, env)
+		return evalBlockStatements(ctx, node, env)
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return evalIfExpression(ctx, node, env)
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
+		val := eval(ctx, node.Value, env)
 		if isError(val) {
 			return val
 		}
 		env.Set(node.Name.Value, val)
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
+		val := eval(ctx, node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
@@ -64,19 +87,19 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		body := node.Body
 		return &object.Function{Parameters: params, Env: env, Body: body}
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
+		function := eval(ctx, node.Function, env)
 		if isError(function) {
 			return function
 		}
-		args := evalExpressions(node.Arguments, env)
+		args := evalExpressions(ctx, node.Arguments, env)
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args)
+		return applyFunction(ctx, function, args)
 	case *ast.ArrayLiteral:
 		array := &object.Array{Elements: make([]object.Object, 0, len(node.Elements))}
 		for _, e := range node.Elements {
-			val := Eval(e, env)
+			val := eval(ctx, e, env)
 			if isError(val) {
 				return val
 			}
@@ -84,25 +107,27 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return array
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return evalHashLiteral(ctx, node, env)
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
+		left := eval(ctx, node.Left, env)
 		if isError(left) {
 			return left
 		}
-		index := Eval(node.Index, env)
+		index := eval(ctx, node.Index, env)
 		if isError(index) {
 			return index
 		}
 		return evalIndexExpression(left, index)
+	case *ast.AssignExpression:
+		return evalAssignExpression(ctx, node, env)
 	}
 	return nil
 }
 
-func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+func evalProgram(ctx context.Context, program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 	for _, stmt := range program.Statements {
-		result = Eval(stmt, env)
+		result = eval(ctx, stmt, env)
 
 		switch res := result.(type) {
 		case *object.ReturnValue:
@@ -114,10 +139,10 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	return result
 }
 
-func evalBlockStatements(block *ast.BlockStatement, env *object.Environment) object.Object {
+func evalBlockStatements(ctx context.Context, block *ast.BlockStatement, env *object.Environment) object.Object {
 	var result object.Object
 	for _, stmt := range block.Statements {
-		result = Eval(stmt, env)
+		result = eval(ctx, stmt, env)
 		if result != nil {
 			typ := result.Type()
 			if typ == object.RETURN_VALUE || typ == object.ERROR {
@@ -136,14 +161,13 @@ func toBooleanObject(input bool) object.Object {
 }
 
 func evalIdentifier(ident *ast.Identifier, env *object.Environment) object.Object {
-	builtin, ok := builtins[ident.Value]
-	if ok {
-		return builtin
-	}
-	val, ok := env.Get(ident.Value)
-	if ok {
+	// VMと同じく、letで定義した変数は同名のbuiltin関数より優先する
+	if val, ok := env.Get(ident.Value); ok {
 		return val
 	}
+	if builtin := object.GetBuiltinByName(ident.Value); builtin != nil {
+		return builtin
+	}
 	return newError("identifier not found: %s", ident.Value)
 }
 
@@ -154,6 +178,9 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 	if operator == "-" {
 		return evalMinusOperatorExpression(right)
 	}
+	if operator == "~" && right.Type() == object.INTEGER {
+		return object.NotInteger(right)
+	}
 	return newError("unknown operator: %s%s", operator, right.Type())
 }
 
@@ -168,14 +195,19 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusOperatorExpression(right object.Object) object.Object {
-	rightObj, ok := right.(*object.Integer)
-	if !ok {
-		return newError("unknown operator: -%s", right.Type())
+	switch right := right.(type) {
+	case *object.Integer, *object.BigInt:
+		return object.NegateInteger(right)
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
 	}
-	return &object.Integer{Value: -rightObj.Value}
+	return newError("unknown operator: -%s", right.Type())
 }
 
 func evalInfixExpression(operator string, left, right object.Object) object.Object {
+	if object.IsFloatOperation(left, right) {
+		return evalFloatInfixExpression(operator, left, right)
+	}
 	if left.Type() != right.Type() {
 		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
 	}
@@ -197,21 +229,69 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 }
 
 func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
-	leftVal := left.(*object.Integer).Value
-	rightVal := right.(*object.Integer).Value
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		return object.AddIntegers(left, right)
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		return object.SubIntegers(left, right)
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		return arithmeticResult(object.MulIntegers(left, right))
 	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
+		return arithmeticResult(object.DivIntegers(left, right))
+	case "%":
+		return arithmeticResult(object.ModIntegers(left, right))
+	case "**":
+		return arithmeticResult(object.PowIntegers(left, right))
+	case "&":
+		return object.AndIntegers(left, right)
+	case "|":
+		return object.OrIntegers(left, right)
+	case "^":
+		return object.XorIntegers(left, right)
+	case "<<":
+		return arithmeticResult(object.ShiftLeftIntegers(left, right))
+	case ">>":
+		return arithmeticResult(object.ShiftRightIntegers(left, right))
+	case ">":
+		return toBooleanObject(object.CompareIntegers(left, right) > 0)
+	case "<":
+		return toBooleanObject(object.CompareIntegers(left, right) < 0)
+	case ">=":
+		return toBooleanObject(object.CompareIntegers(left, right) >= 0)
+	case "<=":
+		return toBooleanObject(object.CompareIntegers(left, right) <= 0)
+	case "==":
+		return toBooleanObject(object.CompareIntegers(left, right) == 0)
+	case "!=":
+		return toBooleanObject(object.CompareIntegers(left, right) != 0)
+	}
+	return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+}
+
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal, _ := object.ToFloat64(left)
+	rightVal, _ := object.ToFloat64(right)
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		return floatResult(object.DivFloats(leftVal, rightVal))
+	case "%":
+		return floatResult(object.ModFloats(leftVal, rightVal))
+	case "**":
+		return floatResult(object.PowFloats(leftVal, rightVal))
 	case ">":
 		return toBooleanObject(leftVal > rightVal)
 	case "<":
 		return toBooleanObject(leftVal < rightVal)
+	case ">=":
+		return toBooleanObject(leftVal >= rightVal)
+	case "<=":
+		return toBooleanObject(leftVal <= rightVal)
 	case "==":
 		return toBooleanObject(leftVal == rightVal)
 	case "!=":
@@ -220,26 +300,71 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 }
 
-func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
-	if operator != "+" {
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+// arithmeticResult 0による除算などの演算のエラーをobject.Errorにする
+func arithmeticResult(result object.Object, err error) object.Object {
+	if err != nil {
+		return newError("%s", err)
 	}
+	return result
+}
+
+func floatResult(result float64, err error) object.Object {
+	if err != nil {
+		return newError("%s", err)
+	}
+	return &object.Float{Value: result}
+}
+
+// evalStringInfixExpression 文字列はbyte列として辞書順で比較する
+func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.String).Value
-	return &object.String{Value: leftVal + rightVal}
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case ">":
+		return toBooleanObject(leftVal > rightVal)
+	case "<":
+		return toBooleanObject(leftVal < rightVal)
+	case ">=":
+		return toBooleanObject(leftVal >= rightVal)
+	case "<=":
+		return toBooleanObject(leftVal <= rightVal)
+	case "==":
+		return toBooleanObject(leftVal == rightVal)
+	case "!=":
+		return toBooleanObject(leftVal != rightVal)
+	}
+	return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+}
+
+// evalLogicalExpression 左辺だけで結果が決まる場合は右辺を評価しない。結果は常に真偽値
+func evalLogicalExpression(ctx context.Context, node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := eval(ctx, node.Left, env)
+	if isError(left) {
+		return left
+	}
+	if isTruthy(left) == (node.Operator == "||") {
+		return toBooleanObject(isTruthy(left))
+	}
+	right := eval(ctx, node.Right, env)
+	if isError(right) {
+		return right
+	}
+	return toBooleanObject(isTruthy(right))
 }
 
-func evalIfExpression(exp *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(exp.Condition, env)
+func evalIfExpression(ctx context.Context, exp *ast.IfExpression, env *object.Environment) object.Object {
+	condition := eval(ctx, exp.Condition, env)
 	if isError(condition) {
 		return condition
 	}
 
 	if isTruthy(condition) {
-		return Eval(exp.Consequence, env)
+		return eval(ctx, exp.Consequence, env)
 	}
 	if exp.Alternative != nil {
-		return Eval(exp.Alternative, env)
+		return eval(ctx, exp.Alternative, env)
 	}
 	return NULL
 }
@@ -247,7 +372,15 @@ func evalIfExpression(exp *ast.IfExpression, env *object.Environment) object.Obj
 func evalIndexExpression(left, index object.Object) object.Object {
 	switch left := left.(type) {
 	case *object.Array:
-		return left.Elements[index.(*object.Integer).Value]
+		if index.Type() != object.INTEGER {
+			return newError("invalid index expression. %s[%s]", left.Type(), index.Type())
+		}
+		// int64に収まらない添字は必ず範囲外になる
+		i, ok := index.(*object.Integer)
+		if !ok || i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return NULL
+		}
+		return left.Elements[i.Value]
 	case *object.Hash:
 		hashKey, ok := index.(object.Hashable)
 		if !ok {
@@ -262,14 +395,69 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	return newError("invalid index expression. %s[%s]", left.Type(), index.Type())
 }
 
-func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+// evalAssignExpression 変数への代入は、その変数が定義されたスコープの値を更新する
+func evalAssignExpression(ctx context.Context, node *ast.AssignExpression, env *object.Environment) object.Object {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		val := eval(ctx, node.Value, env)
+		if isError(val) {
+			return val
+		}
+		if !env.Assign(target.Value, val) {
+			return newError("identifier not found: %s", target.Value)
+		}
+		return val
+	case *ast.IndexExpression:
+		left := eval(ctx, target.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := eval(ctx, target.Index, env)
+		if isError(index) {
+			return index
+		}
+		val := eval(ctx, node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return evalSetIndex(left, index, val)
+	}
+	return newError("cannot assign to %s", node.Target)
+}
+
+// evalSetIndex 配列は既存の要素のみ更新でき、ハッシュはキーがなければ追加する
+func evalSetIndex(left, index, val object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		if index.Type() != object.INTEGER {
+			return newError("invalid index expression. %s[%s]", left.Type(), index.Type())
+		}
+		// int64に収まらない添字は必ず範囲外になる
+		i, ok := index.(*object.Integer)
+		if !ok || i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return newError("index out of range: %s", index.Inspect())
+		}
+		left.Elements[i.Value] = val
+		return val
+	case *object.Hash:
+		hashKey, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unhashable type %s", index.Type())
+		}
+		left.Pairs[hashKey.HashKey()] = object.HashPair{Key: index, Value: val}
+		return val
+	}
+	return newError("invalid index expression. %s[%s]", left.Type(), index.Type())
+}
+
+func evalHashLiteral(ctx context.Context, node *ast.HashLiteral, env *object.Environment) object.Object {
 	pairs := make(map[object.HashKey]object.HashPair)
 	for k, v := range node.Pairs {
-		key := Eval(k, env)
+		key := eval(ctx, k, env)
 		if isError(key) {
 			return key
 		}
-		val := Eval(v, env)
+		val := eval(ctx, v, env)
 		if isError(val) {
 			return val
 		}
@@ -282,10 +470,10 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 	return &object.Hash{Pairs: pairs}
 }
 
-func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+func evalExpressions(ctx context.Context, exps []ast.Expression, env *object.Environment) []object.Object {
 	result := make([]object.Object, 0)
 	for _, e := range exps {
-		evaluated := Eval(e, env)
+		evaluated := eval(ctx, e, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
@@ -294,13 +482,20 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+func applyFunction(ctx context.Context, fn object.Object, args []object.Object) object.Object {
 	switch fn := fn.(type) {
 	case *object.Builtin:
-		return fn.Fn(args...)
+		if result := fn.Fn(args...); result != nil {
+			return result
+		}
+		return NULL
 	case *object.Function:
+		// 再帰呼び出しが止まらない場合に備えて、関数の呼び出しごとにキャンセルを確認する
+		if err := ctx.Err(); err != nil {
+			return newError("%s", &object.CanceledError{Err: err})
+		}
 		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
+		evaluated := eval(ctx, fn.Body, extendedEnv)
 		return unwrapReturnValue(evaluated)
 	}
 	return newError("not a function: %s", fn.Type())
@@ -1,7 +1,9 @@
 package evaluator
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -240,6 +242,8 @@ func TestEval_IndexExpression(t *testing.T) {
 		{"let arr = [1, 2]; arr[1];", 2},
 		{"let arr = [1, 2]; len(arr);", 2},
 		{`let hash = {"key": 1}; hash["key"];`, 1},
+		{`len("日本語")`, 9},
+		{`let 文字列 = "日本語"; runeLen(文字列)`, 3},
 	}
 
 	for _, tt := range tests {
@@ -251,3 +255,256 @@ func TestEval_IndexExpression(t *testing.T) {
 		assert.Equal(t, tt.expected, obj.(*object.Integer).Value)
 	}
 }
+
+func TestEval_IndexOutOfRange(t *testing.T) {
+	for _, input := range []string{
+		"[1, 2, 3][5]",
+		"[1, 2, 3][3]",
+		"let a = [1]; a[-1]",
+		"[][0]",
+		"[1][18446744073709551616]",
+	} {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		assert.Same(t, NULL, Eval(program, object.NewEnvironment()), input)
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	input := `let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(50)`
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := EvalContext(ctx, program, object.NewEnvironment())
+	assert.ErrorIs(t, err, object.ErrCanceled)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	obj, err := EvalContext(context.Background(), parser.New(lexer.New("-true")).ParseProgram(), object.NewEnvironment())
+	assert.NoError(t, err)
+	assert.Equal(t, "unknown operator: -BOOLEAN", obj.(*object.Error).Message)
+}
+
+func TestEval_FloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1.5", 1.5},
+		{"1.5 + 2", 3.5},
+		{"3 - 0.5", 2.5},
+		{"-1.5 * 2", -3.0},
+		{"1 / 4.0", 0.25},
+		{"1.5 > 1", true},
+		{"1 < 0.5", false},
+		{"2 == 2.0", true},
+		{"round(2.345, 1) + floor(1.5)", 3.3},
+		{"round(1.5, 400)", 1.5},
+		{"round(1e300, 10)", 1e300},
+		{"round(123.0, -400)", 0.0},
+		{"ceil(1.2) + int(2.9)", int64(4)},
+		{"let floor = 3; floor + 1", int64(4)},
+		{"let f = fn() { let ceil = 2; ceil }; f() + ceil(0.5)", int64(3)},
+		{`{1: 1.5}[1.0]`, 1.5},
+		{`1.5 + "a"`, "type mismatch: FLOAT + STRING"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		env := object.NewEnvironment()
+		obj := Eval(program, env)
+		switch expected := tt.expected.(type) {
+		case float64:
+			assert.InDelta(t, expected, obj.(*object.Float).Value, 1e-9, tt.input)
+		case int64:
+			assert.Equal(t, expected, obj.(*object.Integer).Value, tt.input)
+		case bool:
+			assert.Equal(t, expected, obj.(*object.Boolean).Value, tt.input)
+		case string:
+			assert.Equal(t, expected, obj.(*object.Error).Message, tt.input)
+		}
+	}
+}
+
+func TestEval_BigInteger(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"4294967296 * 4294967296", "18446744073709551616"},
+		{"18446744073709551616 / 4294967296", "4294967296"},
+		{"-18446744073709551616", "-18446744073709551616"},
+		{"18446744073709551616 > 1", "true"},
+		{"99999999999999999999 - 99999999999999999998 == 1", "true"},
+		{`{18446744073709551616: "big"}[4294967296 * 4294967296]`, "big"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		env := object.NewEnvironment()
+		obj := Eval(program, env)
+		assert.Equal(t, tt.expected, obj.Inspect(), tt.input)
+	}
+}
+
+// TestEval_Arithmetic 入力と結果はvm.TestVM_Arithmeticと揃えている
+func TestEval_Arithmetic(t *testing.T) {
+	testInspect(t, []inspectTest{
+		{"7 / 2", "3"},
+		{"-7 / 2", "-4"},
+		{"7 / -2", "-4"},
+		{"-7 / -2", "3"},
+		{"7 % 3", "1"},
+		{"-7 % 3", "2"},
+		{"7 % -3", "-2"},
+		{"-7 % -3", "-1"},
+		{"7 / 2.0", "3.5"},
+		{"-7.5 % 2", "0.5"},
+		{"7.5 % -2", "-0.5"},
+		{"2 ** 10", "1024"},
+		{"2 ** 3 ** 2", "512"},
+		{"-2 ** 2", "-4"},
+		{"(-2) ** 3", "-8"},
+		{"2 ** -2", "0.25"},
+		{"9 ** 0.5", "3.0"},
+		{"2 ** 64", "18446744073709551616"},
+		{"18446744073709551616 % 7", "2"},
+		{"-18446744073709551616 / 3", "-6148914691236517206"},
+		{"let x = 1 << 8000000; x * x", "product too large: 16000002 bits"},
+		{"1 / 0", "division by zero"},
+		{"1 % 0", "division by zero"},
+		{"1.5 / 0", "division by zero"},
+		{"1 % 0.0", "division by zero"},
+		{"18446744073709551616 / 0", "division by zero"},
+		{"0 ** -1", "division by zero"},
+		{"0.0 ** -1", "division by zero"},
+		{"fn(x) { x / 0 }(1)", "division by zero"},
+	})
+}
+
+type inspectTest struct {
+	input    string
+	expected string // 結果のInspect。エラーの場合はメッセージ
+}
+
+func testInspect(t *testing.T, tests []inspectTest) {
+	t.Helper()
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		obj := Eval(program, object.NewEnvironment())
+		if errObj, ok := obj.(*object.Error); ok {
+			assert.Equal(t, tt.expected, errObj.Message, tt.input)
+			continue
+		}
+		assert.Equal(t, tt.expected, obj.Inspect(), tt.input)
+	}
+}
+
+// TestEval_Comparison 入力と結果はvm.TestVM_Comparisonと揃えている
+func TestEval_Comparison(t *testing.T) {
+	testInspect(t, []inspectTest{
+		{"1 <= 1", "true"},
+		{"2 <= 1", "false"},
+		{"1 >= 1", "true"},
+		{"0 >= 1", "false"},
+		{"1.5 <= 1", "false"},
+		{"1 >= 0.5", "true"},
+		{"18446744073709551616 >= 9223372036854775807", "true"},
+		{`"a" < "b"`, "true"},
+		{`"b" <= "a"`, "false"},
+		{`"abc" > "abd"`, "false"},
+		{`"abc" >= "ab"`, "true"},
+		{`"a" < "ä"`, "true"},
+		{`"a" == "a"`, "true"},
+		{`"a" != "a"`, "false"},
+		{"true && true", "true"},
+		{"1 && 2", "true"},
+		{"true && if (false) { 1 }", "false"},
+		{"false || false", "false"},
+		{"false || 0", "true"},
+		{"1 < 2 && 2 < 3", "true"},
+		{"let x = 5; x >= 0 && x <= 10", "true"},
+		{"fn(n) { n > 0 && n % 2 == 0 }(3)", "false"},
+		{"false && 1 / 0", "false"},
+		{"true || 1 / 0", "true"},
+		{"true && 1 / 0", "division by zero"},
+		{"false || 1 / 0", "division by zero"},
+		// 左辺から評価する
+		{"let x = 1; (x = 2) <= x", "true"},
+		{"let x = 1; x < (x = 2)", "true"},
+		{"let a = [0]; (a[0] = 1) < (a[0] = 2); a[0]", "2"},
+		{"let a = [0]; (a[0] = 2) <= (a[0] = 1); a[0]", "1"},
+		{"1 < 1 / 0", "division by zero"},
+	})
+}
+
+// TestEval_Bitwise エラーメッセージ以外はvm.TestVM_Bitwiseと揃えている
+func TestEval_Bitwise(t *testing.T) {
+	testInspect(t, []inspectTest{
+		{"6 & 3", "2"},
+		{"6 | 3", "7"},
+		{"6 ^ 3", "5"},
+		{"~5", "-6"},
+		{"~-1", "0"},
+		{"-1 & 255", "255"},
+		{"1 << 4", "16"},
+		{"256 >> 4", "16"},
+		{"-16 >> 2", "-4"},
+		{"1 << 2 + 1", "8"},
+		{"1 << 64", "18446744073709551616"},
+		{"(1 << 64) >> 63", "2"},
+		{"~(1 << 64)", "-18446744073709551617"},
+		{"let READ = 1; let WRITE = 2; let perm = READ | WRITE; perm & WRITE != 0 && perm & 4 == 0", "true"},
+		{"1 << -1", "negative shift count: -1"},
+		{"1 >> -3", "negative shift count: -3"},
+		{"1 << 9223372036854775807", "shift count too large: 9223372036854775807"},
+		{"1 >> 100000000000000000000", "0"},
+		{"-1 >> 100000000000000000000", "-1"},
+		{"0 << 100000000000000000000", "0"},
+		{"1 << 100000000000000000000", "shift count too large: 100000000000000000000"},
+		{"~true", "unknown operator: ~BOOLEAN"},
+		{"1.5 & 1", "unknown operator: FLOAT & INTEGER"},
+	})
+}
+
+func TestEval_Assign(t *testing.T) {
+	testInspect(t, []inspectTest{
+		{"let x = 1; x = x + 1; x", "2"},
+		{"let x = 1; let y = x = 5; x + y", "10"},
+		{"let a = 1; let b = 2; a = b = 3; a + b", "6"},
+		{"let f = fn() { let x = 1; x = x + 10; x }; f()", "11"},
+		{"let f = fn(n) { n = n * 2; n }; f(21)", "42"},
+		{"let g = 1; let f = fn() { g = g + 1 }; f(); f(); g", "3"},
+		{"let counter = fn() { let c = 0; fn() { c = c + 1 } }; let next = counter(); next(); next(); next()", "3"},
+		{"let counter = fn() { let c = 0; fn() { c = c + 1 } }; let a = counter(); let b = counter(); a(); a(); b()", "1"},
+		{"let counter = fn() { let c = 0; fn() { c = c + 1 } }; let a = counter(); a(); let b = counter(); b(); a()", "2"},
+		{"let f = fn() { let c = 0; let inc = fn() { c = c + 1 }; inc(); inc(); c }; f()", "2"},
+		{"let f = fn() { let c = 0; let get = fn() { c }; c = 5; get() }; f()", "5"},
+		{"let pair = fn() { let v = 0; [fn(x) { v = x }, fn() { v }] }; let p = pair(); p[0](7); p[1]()", "7"},
+		{"let f = fn() { let c = 0; fn() { fn() { c = c + 1 } } }; let g = f(); g()(); g()()", "2"},
+		{"let f = fn() { f = 5; 1 }; f(); f", "5"},
+		{"let f = fn(n) { if (n == 0) { return 0; } f(n - 1) }; let g = f; f = fn(n) { 100 }; g(1)", "100"},
+		{"let w = fn() { let f = fn(n) { if (n == 0) { return 0; } f(n - 1) }; let g = f; f = fn(n) { 100 }; g(1) }; w()", "100"},
+		{"let arr = [1, 2, 3]; arr[1] = 20; arr", "[1, 20, 3]"},
+		{"let arr = [1, 2]; let alias = arr; alias[0] = 5; arr[0]", "5"},
+		{"let arr = [1]; arr[0] = arr[0] + 1", "2"},
+		{"let m = [[1], [2]]; m[1][0] = 9; m[1][0]", "9"},
+		{`let h = {"a": 1}; h["a"] = 2; h["b"] = 3; h["a"] + h["b"]`, "5"},
+		{`let h = {}; h[1] = "one"; h[1.0]`, "one"},
+		{"let a = [0]; a[0] = a; a", "[[...]]"},
+		{"let a = [1]; let b = [a, a]; a[0] = b; b", "[[[...]], [[...]]]"},
+		{`let h = {}; h["self"] = h; h`, "{self:{...}}"},
+		{`let a = [0]; a[0] = {"a": a}; a`, "[{a:[...]}]"},
+		{"let arr = [1]; arr[1] = 2", "index out of range: 1"},
+		{"let arr = [1]; arr[-1] = 2", "index out of range: -1"},
+		{"let arr = [1]; arr[18446744073709551616] = 2", "index out of range: 18446744073709551616"},
+		{"x = 1", "identifier not found: x"},
+		{`let h = {}; h[[]] = 1`, "unhashable type ARRAY"},
+	})
+}
@@ -0,0 +1,134 @@
+package interpreter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/karamaru-alpha/monkey/compiler"
+	"github.com/karamaru-alpha/monkey/lexer"
+	"github.com/karamaru-alpha/monkey/object"
+	"github.com/karamaru-alpha/monkey/parser"
+	"github.com/karamaru-alpha/monkey/vm"
+)
+
+// MaxBuiltins OpGetBuiltinのoperandは1byteのため、登録できる関数の数には上限がある
+const MaxBuiltins = 256
+
+// Interpreter compilerとvmをまとめて扱う。登録した関数や定義されたグローバル変数はインスタンスごとに独立している
+type Interpreter struct {
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []object.Object
+	builtins    []*object.Builtin
+	vmOptions   []vm.Option
+	gasUsed     uint64
+}
+
+// New optsはRunやCallのたびに生成されるvmに適用される。vm.WithGasLimitの上限はRunとCallで消費したgasの合計に対して適用される
+func New(opts ...vm.Option) *Interpreter {
+	i := &Interpreter{
+		vmOptions:   opts,
+		symbolTable: compiler.NewSymbolTable(),
+		constants:   make([]object.Object, 0),
+		globals:     make([]object.Object, vm.GlobalsSize),
+		builtins:    make([]*object.Builtin, 0, len(object.Builtins)),
+	}
+	for _, def := range object.Builtins {
+		i.symbolTable.DefineBuiltin(len(i.builtins), def.Name)
+		i.builtins = append(i.builtins, def.Builtin)
+	}
+	return i
+}
+
+// Register スクリプトから呼び出せるGoの関数を登録する。既存のbuiltinと同名の場合は置き換える
+func (i *Interpreter) Register(name string, fn object.BuiltinFunction) error {
+	if fn == nil {
+		return fmt.Errorf("function %s is nil", name)
+	}
+	builtin := &object.Builtin{Fn: fn}
+
+	if symbol, ok := i.symbolTable.Resolve(name); ok {
+		if symbol.Scope != compiler.BuiltinScope {
+			return fmt.Errorf("%s is already defined as a variable", name)
+		}
+		i.builtins[symbol.Index] = builtin
+		return nil
+	}
+
+	if len(i.builtins) >= MaxBuiltins {
+		return fmt.Errorf("too many builtin functions. max: %d", MaxBuiltins)
+	}
+	i.symbolTable.DefineBuiltin(len(i.builtins), name)
+	i.builtins = append(i.builtins, builtin)
+	return nil
+}
+
+// RegisterFunc 任意のGoの関数をobject.WrapFuncで変換して登録する
+func (i *Interpreter) RegisterFunc(name string, fn interface{}) error {
+	builtin, err := object.WrapFunc(fn)
+	if err != nil {
+		return err
+	}
+	return i.Register(name, builtin.Fn)
+}
+
+// Run 入力をコンパイルして実行し、最後に評価された値を返す
+func (i *Interpreter) Run(input string) (object.Object, error) {
+	return i.RunContext(context.Background(), input)
+}
+
+// RunContext ctxがキャンセルされると実行を中断し、object.ErrCanceledを満たすエラーを返す
+func (i *Interpreter) RunContext(ctx context.Context, input string) (object.Object, error) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.ParseErrors(); len(errs) > 0 {
+		return nil, errs
+	}
+
+	comp := compiler.NewWithState(i.symbolTable, i.constants)
+	if err := comp.Compile(program); err != nil {
+		return nil, err
+	}
+	bytecode := comp.Bytecode()
+	i.constants = bytecode.Constants
+
+	machine := i.newVM(bytecode)
+	err := machine.RunContext(ctx)
+	i.gasUsed = machine.GasUsed()
+	if err != nil {
+		return nil, err
+	}
+	return machine.LastPoppedStackElem(), nil
+}
+
+// Call Runで定義されたグローバルな関数をGoから呼び出す
+func (i *Interpreter) Call(name string, args ...object.Object) (object.Object, error) {
+	return i.CallContext(context.Background(), name, args...)
+}
+
+func (i *Interpreter) CallContext(ctx context.Context, name string, args ...object.Object) (object.Object, error) {
+	machine := i.newVM(&compiler.Bytecode{Constants: i.constants})
+	fn, err := machine.LookupGlobal(i.symbolTable, name)
+	if err != nil {
+		return nil, err
+	}
+	result, err := machine.CallContext(ctx, fn, args...)
+	i.gasUsed = machine.GasUsed()
+	return result, err
+}
+
+// GasUsed これまでのRunとCallで消費したgasの合計
+func (i *Interpreter) GasUsed() uint64 {
+	return i.gasUsed
+}
+
+// ResetGas 消費したgasを0に戻す。実行ごとに上限を設ける場合は、RunやCallの前に呼び出す
+func (i *Interpreter) ResetGas() {
+	i.gasUsed = 0
+}
+
+func (i *Interpreter) newVM(bytecode *compiler.Bytecode) *vm.VM {
+	opts := append([]vm.Option{vm.WithGlobalsStore(i.globals), vm.WithBuiltins(i.builtins)}, i.vmOptions...)
+	opts = append(opts, vm.WithGasUsed(i.gasUsed))
+	return vm.New(bytecode, opts...)
+}
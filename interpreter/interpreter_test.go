@@ -0,0 +1,179 @@
+package interpreter
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/karamaru-alpha/monkey/object"
+	"github.com/karamaru-alpha/monkey/parser"
+	"github.com/karamaru-alpha/monkey/vm"
+)
+
+func TestInterpreter_Register(t *testing.T) {
+	double := func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	}
+
+	i := New()
+	assert.NoError(t, i.Register("double", double))
+
+	result, err := i.Run(`let f = fn(x) { double(x) + len([1]) }; f(3)`)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), result.(*object.Integer).Value)
+
+	// グローバル変数は同じインスタンスの次の実行に引き継がれる
+	result, err = i.Run(`f(4)`)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(9), result.(*object.Integer).Value)
+
+	// 他のインスタンスからは見えない
+	_, err = New().Run(`double(1)`)
+	assert.EqualError(t, err, "undefined variable double")
+}
+
+func TestInterpreter_RegisterOverride(t *testing.T) {
+	i := New()
+	assert.NoError(t, i.Register("len", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: 100}
+	}))
+
+	result, err := i.Run(`len([])`)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), result.(*object.Integer).Value)
+
+	result, err = New().Run(`len([])`)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), result.(*object.Integer).Value)
+}
+
+func TestInterpreter_RegisterFunc(t *testing.T) {
+	i := New()
+	assert.NoError(t, i.RegisterFunc("join", func(sep string, words []string) string {
+		return strings.Join(words, sep)
+	}))
+
+	result, err := i.Run(`join("-", ["a", "b"])`)
+	assert.NoError(t, err)
+	assert.Equal(t, "a-b", result.(*object.String).Value)
+
+	assert.EqualError(t, i.RegisterFunc("x", 1), "not a function: int")
+}
+
+func TestInterpreter_RegisterError(t *testing.T) {
+	i := New()
+	_, err := i.Run(`let a = 1;`)
+	assert.NoError(t, err)
+
+	fn := func(args ...object.Object) object.Object { return nil }
+	assert.EqualError(t, i.Register("a", fn), "a is already defined as a variable")
+	assert.EqualError(t, i.Register("b", nil), "function b is nil")
+}
+
+func TestInterpreter_Call(t *testing.T) {
+	i := New()
+	_, err := i.Run(`let base = 10; let add = fn(a, b) { base + a + b }; let notFn = 1;`)
+	assert.NoError(t, err)
+
+	result, err := i.Call("add", &object.Integer{Value: 1}, &object.Integer{Value: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(13), result.(*object.Integer).Value)
+
+	_, err = i.Call("add", &object.Integer{Value: 1})
+	assert.EqualError(t, err, "wrong number of arguments: want=2, got=1")
+	_, err = i.Call("notFn")
+	assert.EqualError(t, err, "calling non-function")
+	_, err = i.Call("undefined")
+	assert.EqualError(t, err, "undefined global variable undefined")
+}
+
+func TestInterpreter_UninitializedGlobal(t *testing.T) {
+	i := New()
+	_, err := i.Run(`let a = 1; let b = c;`)
+	assert.EqualError(t, err, "undefined variable c")
+	_, err = i.Run(`a + 1`)
+	assert.ErrorContains(t, err, "global variable is not initialized")
+
+	_, err = i.Run(`let x = fn() { 1 / 0 }();`)
+	assert.ErrorIs(t, err, object.ErrDivisionByZero)
+	_, err = i.Run(`x + 1`)
+	assert.ErrorContains(t, err, "global variable is not initialized")
+	_, err = i.Call("x")
+	assert.EqualError(t, err, "global variable x is not initialized")
+
+	result, err := i.Run(`x = 2; x + 1`)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), result.(*object.Integer).Value)
+}
+
+func TestInterpreter_ParseError(t *testing.T) {
+	_, err := New().Run("let = 1;\nlet x = (2;")
+	assert.EqualError(t, err, "1:5: expected IDENT, got ASSIGN \"=\"\n2:11: expected RPAREN, got SEMICOLON \";\"")
+
+	var errs parser.ErrorList
+	assert.ErrorAs(t, err, &errs)
+	assert.Len(t, errs, 2)
+
+	_, err = New().Run(`let s = "abc;`)
+	assert.EqualError(t, err, "1:9: unterminated string literal")
+}
+
+func TestInterpreter_StringEscape(t *testing.T) {
+	result, err := New().Run("\"a\\tb\\u{3042}\" + `\\n`")
+	assert.NoError(t, err)
+	assert.Equal(t, "a\tbあ\\n", result.(*object.String).Value)
+}
+
+func TestInterpreter_RunContext(t *testing.T) {
+	i := New()
+	_, err := i.Run(`let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };`)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = i.CallContext(ctx, "fib", &object.Integer{Value: 50})
+	assert.ErrorIs(t, err, object.ErrCanceled)
+
+	_, err = i.RunContext(ctx, `fib(50)`)
+	assert.ErrorIs(t, err, object.ErrCanceled)
+}
+
+func TestInterpreter_VMOptions(t *testing.T) {
+	i := New(vm.WithGasLimit(100))
+	_, err := i.Run(`let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };`)
+	assert.NoError(t, err)
+
+	_, err = i.Call("fib", &object.Integer{Value: 20})
+	assert.ErrorIs(t, err, vm.ErrOutOfGas)
+}
+
+func TestInterpreter_Gas(t *testing.T) {
+	i := New(vm.WithGasLimit(100))
+	// OpClosure(3) OpSetGlobal(1)
+	_, err := i.Run(`let f = fn(a) { a + 1 };`)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), i.GasUsed())
+
+	// OpGetLocal(1) OpConstant(1) OpAdd(1) OpReturn(1)
+	_, err = i.Call("f", &object.Integer{Value: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(8), i.GasUsed())
+
+	// 上限はRunとCallで消費したgasの合計に適用される
+	for err == nil {
+		_, err = i.Call("f", &object.Integer{Value: 1})
+	}
+	assert.ErrorIs(t, err, vm.ErrOutOfGas)
+	assert.Equal(t, uint64(100), i.GasUsed())
+	_, err = i.Run(`1`)
+	assert.ErrorIs(t, err, vm.ErrOutOfGas)
+
+	i.ResetGas()
+	assert.Equal(t, uint64(0), i.GasUsed())
+	_, err = i.Call("f", &object.Integer{Value: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), i.GasUsed())
+}
@@ -0,0 +1,17 @@
+package lexer
+
+import (
+	"fmt"
+
+	"github.com/karamaru-alpha/monkey/token"
+)
+
+// Error 字句解析のエラー
+type Error struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
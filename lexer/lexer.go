@@ -1,33 +1,130 @@
 package lexer
 
 import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
 	"github.com/karamaru-alpha/monkey/token"
 )
 
 type Lexer struct {
-	input        string
-	position     int  // 入力における現在の位置
-	ch           byte // 現在検査中の文字
-	readPosition int  // 次読み込む位置(position+1)
+	src          *source
+	position     int  // 入力における現在の位置(byte)
+	ch           rune // 現在検査中の文字
+	readPosition int  // 次読み込む位置(position+chのbyte数)
+	line         int  // 現在の行(1始まり)
+	lineStart    int  // 現在の行の先頭の位置
+	column       int  // positionの列(1始まり)。文字(rune)単位で数える
+	readColumn   int  // readPositionの列
+
+	keepFrom int // parserのエラー表示のため、直前に返したトークンの行のうちこれ以降は保持する
+
+	keepComments bool
+	errors       []*Error
+}
+
+type Option func(*Lexer)
+
+// WithComments コメントを読み飛ばさず、COMMENTトークンとして返す
+func WithComments() Option {
+	return func(l *Lexer) {
+		l.keepComments = true
+	}
+}
+
+func New(input string, opts ...Option) *Lexer {
+	return newLexer(newStringSource(input), opts...)
+}
+
+// NewReader rから必要な分だけ読み込みながら字句解析する。Newと同じトークン列を返す
+func NewReader(r io.Reader, opts ...Option) *Lexer {
+	return newLexer(newReaderSource(r), opts...)
+}
+
+func newLexer(src *source, opts ...Option) *Lexer {
+	l := &Lexer{src: src, line: 1, readColumn: 1}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
 }
 
-func New(input string) *Lexer {
-	return &Lexer{input: input}
+// Errors 字句解析中に見つかったエラーを返す。エラーがあってもトークンは最後まで返される
+func (l *Lexer) Errors() []*Error {
+	return l.errors
 }
 
 func (l *Lexer) readChar() {
-	if l.readPosition >= len(l.input) {
-		l.ch = 0
+	if l.ch == '\n' {
+		l.line++
+		l.lineStart = l.readPosition
+		l.readColumn = 1
+	}
+	l.column = l.readColumn
+	ch, width := l.src.decodeRune(l.readPosition)
+	if width == 0 {
+		// 入力の終端。位置は終端に留める
+		width = 1
+		if err := l.src.err; err != nil {
+			l.src.err = nil
+			l.addError(l.nextPosition(), fmt.Sprintf("read error: %s", err))
+		}
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.readColumn++
 	}
+	l.ch = ch
 	l.position = l.readPosition
-	l.readPosition += 1
+	l.readPosition += width
 }
 
 func (l *Lexer) NextToken() token.Token {
-	l.readChar()
-	l.skipWhiteSpace()
+	l.src.discard(l.keepFrom)
+	for {
+		l.readChar()
+		l.skipWhiteSpace()
+
+		l.keepFrom = l.lineStart
+		if l.position-lineContext > l.keepFrom {
+			l.keepFrom = l.position - lineContext
+		}
+		pos := l.currentPosition()
+		tok := l.readToken()
+		tok.Pos = pos
+		if tok.Type == token.EOF {
+			tok.End = pos
+		} else {
+			tok.End = l.nextPosition()
+		}
+		if tok.Type == token.COMMENT && !l.keepComments {
+			continue
+		}
+		return tok
+	}
+}
+
+// currentPosition 現在の文字の位置
+func (l *Lexer) currentPosition() token.Position {
+	return l.positionOf(l.position, l.column)
+}
+
+// nextPosition 次に読み込む文字の位置
+func (l *Lexer) nextPosition() token.Position {
+	return l.positionOf(l.readPosition, l.readColumn)
+}
+
+// positionOf 入力の終端より後ろのoffsetは終端の位置として扱う
+func (l *Lexer) positionOf(offset, column int) token.Position {
+	if offset > l.src.end() {
+		offset = l.src.end()
+	}
+	return token.Position{Offset: offset, Line: l.line, Column: column}
+}
+
+func (l *Lexer) readToken() token.Token {
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
@@ -62,13 +159,58 @@ func (l *Lexer) NextToken() token.Token {
 	case '-':
 		return token.New(token.MINUS, l.ch)
 	case '*':
+		if l.peekChar() == '*' {
+			l.readChar()
+			return token.Token{Type: token.POWER, Literal: "**"}
+		}
 		return token.New(token.ASTERISK, l.ch)
+	case '%':
+		return token.New(token.PERCENT, l.ch)
 	case '/':
-		return token.New(token.SLASH, l.ch)
+		switch l.peekChar() {
+		case '/':
+			return token.Token{Type: token.COMMENT, Literal: l.readLineComment()}
+		case '*':
+			return token.Token{Type: token.COMMENT, Literal: l.readBlockComment()}
+		default:
+			return token.New(token.SLASH, l.ch)
+		}
 	case '<':
+		switch l.peekChar() {
+		case '=':
+			l.readChar()
+			return token.Token{Type: token.LT_EQ, Literal: "<="}
+		case '<':
+			l.readChar()
+			return token.Token{Type: token.SHIFT_LEFT, Literal: "<<"}
+		}
 		return token.New(token.LT, l.ch)
 	case '>':
+		switch l.peekChar() {
+		case '=':
+			l.readChar()
+			return token.Token{Type: token.GT_EQ, Literal: ">="}
+		case '>':
+			l.readChar()
+			return token.Token{Type: token.SHIFT_RIGHT, Literal: ">>"}
+		}
 		return token.New(token.GT, l.ch)
+	case '&':
+		if l.peekChar() == '&' {
+			l.readChar()
+			return token.Token{Type: token.AND, Literal: "&&"}
+		}
+		return token.New(token.AMPERSAND, l.ch)
+	case '|':
+		if l.peekChar() == '|' {
+			l.readChar()
+			return token.Token{Type: token.OR, Literal: "||"}
+		}
+		return token.New(token.PIPE, l.ch)
+	case '^':
+		return token.New(token.CARET, l.ch)
+	case '~':
+		return token.New(token.TILDE, l.ch)
 	case '{':
 		return token.New(token.LBRACE, l.ch)
 	case '}':
@@ -78,6 +220,8 @@ func (l *Lexer) NextToken() token.Token {
 		tok.Type = token.STRING
 		tok.Literal = l.readString()
 		return tok
+	case '`':
+		return token.Token{Type: token.STRING, Literal: l.readRawString()}
 	case 0:
 		return token.Token{Type: token.EOF, Literal: ""}
 	default:
@@ -88,10 +232,13 @@ func (l *Lexer) NextToken() token.Token {
 			return tok
 		}
 		if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Literal, tok.Type = l.readNumber()
 			return tok
 		}
+		if l.ch == utf8.RuneError && l.readPosition-l.position == 1 {
+			l.addError(l.currentPosition(), "invalid UTF-8 encoding")
+			return token.Token{Type: token.ILLEGAL, Literal: l.src.slice(l.position, l.readPosition)}
+		}
 		return token.New(token.ILLEGAL, l.ch)
 	}
 }
@@ -102,44 +249,192 @@ func (l *Lexer) skipWhiteSpace() {
 	}
 }
 
-func (l *Lexer) peekChar() byte {
-	if l.readPosition >= len(l.input) {
-		return 0
+func (l *Lexer) peekChar() rune {
+	ch, _ := l.src.decodeRune(l.readPosition)
+	return ch
+}
+
+// peekCharN peekCharのn文字先を返す
+func (l *Lexer) peekCharN(n int) rune {
+	offset := l.readPosition
+	for i := 0; i < n; i++ {
+		_, width := l.src.decodeRune(offset)
+		if width == 0 {
+			return 0
+		}
+		offset += width
 	}
-	return l.input[l.readPosition]
+	ch, _ := l.src.decodeRune(offset)
+	return ch
 }
 
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.peekChar()) {
+	for isLetter(l.peekChar()) || unicode.IsDigit(l.peekChar()) {
 		l.readChar()
 	}
-	return l.input[position:l.readPosition]
+	return l.src.slice(position, l.readPosition)
 }
 
+// readString エスケープシーケンスを解釈した文字列を返す
 func (l *Lexer) readString() string {
+	pos := l.currentPosition()
+	var out strings.Builder
+	for {
+		l.readChar()
+		switch l.ch {
+		case '"':
+			return out.String()
+		case 0:
+			l.addError(pos, "unterminated string literal")
+			return out.String()
+		case '\\':
+			l.readEscape(&out)
+		default:
+			// 不正なUTF-8のbyteもそのまま残す
+			out.WriteString(l.src.slice(l.position, l.readPosition))
+		}
+	}
+}
+
+func (l *Lexer) readEscape(out *strings.Builder) {
+	pos := l.currentPosition()
+	l.readChar()
+	switch l.ch {
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case 'r':
+		out.WriteByte('\r')
+	case '"':
+		out.WriteByte('"')
+	case '\\':
+		out.WriteByte('\\')
+	case 'u':
+		if l.peekChar() != '{' {
+			l.addError(pos, "invalid unicode escape: missing {")
+			return
+		}
+		l.readChar()
+		start := l.readPosition
+		for isHexDigit(l.peekChar()) {
+			l.readChar()
+		}
+		digits := l.src.slice(start, l.readPosition)
+		if l.peekChar() != '}' {
+			l.addError(pos, "invalid unicode escape: missing }")
+			return
+		}
+		l.readChar()
+		code, err := strconv.ParseUint(digits, 16, 32)
+		if err != nil || len(digits) > 6 || !utf8.ValidRune(rune(code)) {
+			l.addError(pos, fmt.Sprintf("invalid unicode code point: %q", digits))
+			return
+		}
+		out.WriteRune(rune(code))
+	case 0:
+		// 入力の終端。呼び出し元で閉じられていない文字列として扱う
+	default:
+		l.addError(pos, fmt.Sprintf("unknown escape sequence: \\%c", l.ch))
+		out.WriteString(l.src.slice(l.position, l.readPosition))
+	}
+}
+
+// readRawString バッククォートで囲まれた文字列をそのまま返す
+func (l *Lexer) readRawString() string {
+	pos := l.currentPosition()
 	position := l.position + 1
 	for {
 		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
-			break
+		if l.ch == '`' {
+			return l.src.slice(position, l.position)
+		}
+		if l.ch == 0 {
+			l.addError(pos, "unterminated raw string literal")
+			return l.src.rest(position)
 		}
 	}
-	return l.input[position:l.position]
 }
 
-func (l *Lexer) readNumber() string {
+func (l *Lexer) addError(pos token.Position, msg string) {
+	l.errors = append(l.errors, &Error{Pos: pos, Message: msg})
+}
+
+// readLineComment 改行の直前までを読む
+func (l *Lexer) readLineComment() string {
 	position := l.position
+	for l.peekChar() != '\n' && l.peekChar() != 0 {
+		l.readChar()
+	}
+	return l.src.slice(position, l.readPosition)
+}
+
+func (l *Lexer) readBlockComment() string {
+	position := l.position
+	pos := l.currentPosition()
+	l.readChar()
+	for {
+		l.readChar()
+		if l.ch == 0 {
+			l.addError(pos, "unterminated block comment")
+			return l.src.rest(position)
+		}
+		if l.ch == '*' && l.peekChar() == '/' {
+			l.readChar()
+			return l.src.slice(position, l.readPosition)
+		}
+	}
+}
+
+// readNumber 小数点か指数部を含む場合はFLOATになる。"1."や"1e"のように後ろに数字が続かない場合は含めない
+func (l *Lexer) readNumber() (string, token.Type) {
+	position := l.position
+	typ := token.INT
+	l.readDigits()
+	if l.peekChar() == '.' && isDigit(l.peekCharN(1)) {
+		typ = token.FLOAT
+		l.readChar()
+		l.readDigits()
+	}
+	if ch := l.peekChar(); ch == 'e' || ch == 'E' {
+		n := 1
+		if sign := l.peekCharN(1); sign == '+' || sign == '-' {
+			n = 2
+		}
+		if isDigit(l.peekCharN(n)) {
+			typ = token.FLOAT
+			for i := 0; i < n; i++ {
+				l.readChar()
+			}
+			l.readDigits()
+		}
+	}
+	return l.src.slice(position, l.readPosition), typ
+}
+
+func (l *Lexer) readDigits() {
 	for isDigit(l.peekChar()) {
 		l.readChar()
 	}
-	return l.input[position:l.readPosition]
 }
 
-func isLetter(ch byte) bool {
-	return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch == '_'
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_'
 }
 
-func isDigit(ch byte) bool {
+// isDigit 数値リテラルはASCIIの数字のみで構成する
+func isDigit(ch rune) bool {
 	return ch >= '0' && ch <= '9'
 }
+
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || ch >= 'a' && ch <= 'f' || ch >= 'A' && ch <= 'F'
+}
+
+// Line posを含む行を改行を除いて返す。長い行はposの前後を省略し、columnには返した行の先頭の文字の列を返す
+// NewReaderの場合、直前に返したトークンより前の部分は得られないことがある
+func (l *Lexer) Line(pos token.Position) (line string, column int) {
+	line, prefix := l.src.line(pos.Offset)
+	return line, pos.Column - prefix
+}
@@ -1,7 +1,12 @@
 package lexer
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/assert"
 
@@ -28,7 +33,9 @@ if (5 < 10) {
 10 == 10;
 10 != 9;
 
-!-/*
+!-/ * % **
+<= >= && ||
+& | ^ ~ << >>
 [1, 2, "hoge", {"key": "val"}];
 `
 	expected := []token.Token{
@@ -97,6 +104,18 @@ if (5 < 10) {
 		{Type: token.MINUS, Literal: "-"},
 		{Type: token.SLASH, Literal: "/"},
 		{Type: token.ASTERISK, Literal: "*"},
+		{Type: token.PERCENT, Literal: "%"},
+		{Type: token.POWER, Literal: "**"},
+		{Type: token.LT_EQ, Literal: "<="},
+		{Type: token.GT_EQ, Literal: ">="},
+		{Type: token.AND, Literal: "&&"},
+		{Type: token.OR, Literal: "||"},
+		{Type: token.AMPERSAND, Literal: "&"},
+		{Type: token.PIPE, Literal: "|"},
+		{Type: token.CARET, Literal: "^"},
+		{Type: token.TILDE, Literal: "~"},
+		{Type: token.SHIFT_LEFT, Literal: "<<"},
+		{Type: token.SHIFT_RIGHT, Literal: ">>"},
 		{Type: token.LBRACKET, Literal: "["},
 		{Type: token.INT, Literal: "1"},
 		{Type: token.COMMA, Literal: ","},
@@ -116,6 +135,275 @@ if (5 < 10) {
 
 	l := New(input)
 	for i := 0; i < len(expected); i++ {
-		assert.Equal(t, expected[i], l.NextToken())
+		tok := l.NextToken()
+		assert.Equal(t, expected[i].Type, tok.Type)
+		assert.Equal(t, expected[i].Literal, tok.Literal)
+	}
+}
+
+func TestLexer_Position(t *testing.T) {
+	input := `let a = 1;
+	a + "b
+c";
+`
+	expected := []struct {
+		pos token.Position
+		end token.Position
+	}{
+		{token.Position{Offset: 0, Line: 1, Column: 1}, token.Position{Offset: 3, Line: 1, Column: 4}},
+		{token.Position{Offset: 4, Line: 1, Column: 5}, token.Position{Offset: 5, Line: 1, Column: 6}},
+		{token.Position{Offset: 6, Line: 1, Column: 7}, token.Position{Offset: 7, Line: 1, Column: 8}},
+		{token.Position{Offset: 8, Line: 1, Column: 9}, token.Position{Offset: 9, Line: 1, Column: 10}},
+		{token.Position{Offset: 9, Line: 1, Column: 10}, token.Position{Offset: 10, Line: 1, Column: 11}},
+		{token.Position{Offset: 12, Line: 2, Column: 2}, token.Position{Offset: 13, Line: 2, Column: 3}},
+		{token.Position{Offset: 14, Line: 2, Column: 4}, token.Position{Offset: 15, Line: 2, Column: 5}},
+		{token.Position{Offset: 16, Line: 2, Column: 6}, token.Position{Offset: 21, Line: 3, Column: 3}},
+		{token.Position{Offset: 21, Line: 3, Column: 3}, token.Position{Offset: 22, Line: 3, Column: 4}},
+		{token.Position{Offset: 23, Line: 4, Column: 1}, token.Position{Offset: 23, Line: 4, Column: 1}},
+	}
+
+	l := New(input)
+	for i := 0; i < len(expected); i++ {
+		tok := l.NextToken()
+		assert.Equal(t, expected[i].pos, tok.Pos)
+		assert.Equal(t, expected[i].end, tok.End)
+	}
+}
+
+func TestLexer_LongLine(t *testing.T) {
+	const n = 200000
+	l := New(strings.Repeat("あ+", n))
+	var tok token.Token
+	for i := 0; i < 2*n; i++ {
+		tok = l.NextToken()
+	}
+	assert.Equal(t, token.Position{Offset: 4*n - 1, Line: 1, Column: 2 * n}, tok.Pos)
+	assert.Equal(t, token.Position{Offset: 4 * n, Line: 1, Column: 2*n + 1}, tok.End)
+	assert.Equal(t, tok.End, l.NextToken().Pos)
+}
+
+func TestLexer_Comment(t *testing.T) {
+	input := `// header
+let a = 1; // trailing
+/* block
+   comment */ a / 2 /**/
+// last`
+
+	tests := []struct {
+		opts     []Option
+		expected []token.Token
+	}{
+		{
+			opts: nil,
+			expected: []token.Token{
+				{Type: token.LET, Literal: "let"},
+				{Type: token.IDENT, Literal: "a"},
+				{Type: token.ASSIGN, Literal: "="},
+				{Type: token.INT, Literal: "1"},
+				{Type: token.SEMICOLON, Literal: ";"},
+				{Type: token.IDENT, Literal: "a"},
+				{Type: token.SLASH, Literal: "/"},
+				{Type: token.INT, Literal: "2"},
+				{Type: token.EOF, Literal: ""},
+			},
+		},
+		{
+			opts: []Option{WithComments()},
+			expected: []token.Token{
+				{Type: token.COMMENT, Literal: "// header"},
+				{Type: token.LET, Literal: "let"},
+				{Type: token.IDENT, Literal: "a"},
+				{Type: token.ASSIGN, Literal: "="},
+				{Type: token.INT, Literal: "1"},
+				{Type: token.SEMICOLON, Literal: ";"},
+				{Type: token.COMMENT, Literal: "// trailing"},
+				{Type: token.COMMENT, Literal: "/* block\n   comment */"},
+				{Type: token.IDENT, Literal: "a"},
+				{Type: token.SLASH, Literal: "/"},
+				{Type: token.INT, Literal: "2"},
+				{Type: token.COMMENT, Literal: "/**/"},
+				{Type: token.COMMENT, Literal: "// last"},
+				{Type: token.EOF, Literal: ""},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		l := New(input, tt.opts...)
+		for i := 0; i < len(tt.expected); i++ {
+			tok := l.NextToken()
+			assert.Equal(t, tt.expected[i].Type, tok.Type)
+			assert.Equal(t, tt.expected[i].Literal, tok.Literal)
+		}
+		assert.Empty(t, l.Errors())
+	}
+
+	l := New("a // x\n/* y */ b", WithComments())
+	l.NextToken()
+	tok := l.NextToken()
+	assert.Equal(t, token.Position{Offset: 2, Line: 1, Column: 3}, tok.Pos)
+	assert.Equal(t, token.Position{Offset: 6, Line: 1, Column: 7}, tok.End)
+	tok = l.NextToken()
+	assert.Equal(t, token.Position{Offset: 7, Line: 2, Column: 1}, tok.Pos)
+	assert.Equal(t, token.Position{Offset: 14, Line: 2, Column: 8}, tok.End)
+	assert.Equal(t, token.Position{Offset: 15, Line: 2, Column: 9}, l.NextToken().Pos)
+}
+
+func TestLexer_UnterminatedComment(t *testing.T) {
+	l := New("1 /* abc\n", WithComments())
+	assert.Equal(t, token.INT, l.NextToken().Type)
+
+	tok := l.NextToken()
+	assert.Equal(t, token.COMMENT, tok.Type)
+	assert.Equal(t, "/* abc\n", tok.Literal)
+	assert.Equal(t, token.EOF, l.NextToken().Type)
+	assert.Equal(t, []*Error{
+		{Pos: token.Position{Offset: 2, Line: 1, Column: 3}, Message: "unterminated block comment"},
+	}, l.Errors())
+	assert.EqualError(t, l.Errors()[0], "1:3: unterminated block comment")
+}
+
+func TestLexer_String(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		errors   []string
+	}{
+		{`"hello"`, "hello", nil},
+		{`"a\nb\tc\r"`, "a\nb\tc\r", nil},
+		{`"say \"hi\" \\ bye"`, `say "hi" \ bye`, nil},
+		{`"\u{41}\u{3042}\u{1F600}"`, "Aあ😀", nil},
+		{"`raw \\n \"string\"\nnext`", "raw \\n \"string\"\nnext", nil},
+		{`"\q"`, "q", []string{`1:2: unknown escape sequence: \q`}},
+		{`"\u41"`, "41", []string{"1:2: invalid unicode escape: missing {"}},
+		{`"\u{41"`, "", []string{"1:2: invalid unicode escape: missing }"}},
+		{`"\u{110000}"`, "", []string{`1:2: invalid unicode code point: "110000"`}},
+		{`"\u{D800}"`, "", []string{`1:2: invalid unicode code point: "D800"`}},
+		{`"abc`, "abc", []string{"1:1: unterminated string literal"}},
+		{`"abc\`, "abc", []string{"1:1: unterminated string literal"}},
+		{"`abc", "abc", []string{"1:1: unterminated raw string literal"}},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+		assert.Equal(t, token.STRING, tok.Type, tt.input)
+		assert.Equal(t, tt.expected, tok.Literal, tt.input)
+		assert.Equal(t, token.EOF, l.NextToken().Type, tt.input)
+
+		errs := make([]string, 0)
+		for _, err := range l.Errors() {
+			errs = append(errs, err.Error())
+		}
+		if tt.errors == nil {
+			tt.errors = []string{}
+		}
+		assert.Equal(t, tt.errors, errs, tt.input)
+	}
+}
+
+func TestLexer_Unicode(t *testing.T) {
+	input := "let 名前 = \"値\"; café_2 + ñ\n× \xff"
+	expected := []struct {
+		typ     token.Type
+		literal string
+		pos     token.Position
+	}{
+		{token.LET, "let", token.Position{Offset: 0, Line: 1, Column: 1}},
+		{token.IDENT, "名前", token.Position{Offset: 4, Line: 1, Column: 5}},
+		{token.ASSIGN, "=", token.Position{Offset: 11, Line: 1, Column: 8}},
+		{token.STRING, "値", token.Position{Offset: 13, Line: 1, Column: 10}},
+		{token.SEMICOLON, ";", token.Position{Offset: 18, Line: 1, Column: 13}},
+		{token.IDENT, "café_2", token.Position{Offset: 20, Line: 1, Column: 15}},
+		{token.PLUS, "+", token.Position{Offset: 28, Line: 1, Column: 22}},
+		{token.IDENT, "ñ", token.Position{Offset: 30, Line: 1, Column: 24}},
+		{token.ILLEGAL, "×", token.Position{Offset: 33, Line: 2, Column: 1}},
+		{token.ILLEGAL, "\xff", token.Position{Offset: 36, Line: 2, Column: 3}},
+		{token.EOF, "", token.Position{Offset: 37, Line: 2, Column: 4}},
+	}
+
+	l := New(input)
+	for _, e := range expected {
+		tok := l.NextToken()
+		assert.Equal(t, e.typ, tok.Type)
+		assert.Equal(t, e.literal, tok.Literal)
+		assert.Equal(t, e.pos, tok.Pos)
+	}
+	assert.Equal(t, []*Error{
+		{Pos: token.Position{Offset: 36, Line: 2, Column: 3}, Message: "invalid UTF-8 encoding"},
+	}, l.Errors())
+}
+
+func TestNewReader(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(&b, "let 変数%d = \"値\\n%d\"; /* c\n */ x%d * `raw\n` // end\n", i, i, i)
+	}
+	b.WriteString(`"unterminated`)
+	input := b.String()
+
+	readers := []io.Reader{
+		strings.NewReader(input),
+		iotest.OneByteReader(strings.NewReader(input)),
+		iotest.HalfReader(strings.NewReader(input)),
+		iotest.DataErrReader(strings.NewReader(input)),
+	}
+	for _, r := range readers {
+		expected := New(input, WithComments())
+		l := NewReader(r, WithComments())
+		for {
+			want := expected.NextToken()
+			assert.Equal(t, want, l.NextToken())
+			if want.Type == token.EOF {
+				break
+			}
+		}
+		assert.Equal(t, expected.Errors(), l.Errors())
+		// 読み終えた部分は破棄されている
+		assert.Less(t, len(l.src.buf), discardThreshold+readChunkSize)
+	}
+}
+
+func TestNewReader_LongLine(t *testing.T) {
+	l := NewReader(strings.NewReader(strings.Repeat("a + ", 100000)))
+	for l.NextToken().Type != token.EOF {
+		// 1行しかなくても読み終えた部分は破棄されている
+		assert.Less(t, len(l.src.buf), lineContext+discardThreshold+readChunkSize)
+	}
+}
+
+func TestNewReader_Error(t *testing.T) {
+	l := NewReader(io.MultiReader(strings.NewReader("a b"), iotest.ErrReader(errors.New("boom"))))
+	assert.Equal(t, "a", l.NextToken().Literal)
+	assert.Equal(t, "b", l.NextToken().Literal)
+	assert.Equal(t, token.EOF, l.NextToken().Type)
+	assert.Equal(t, []*Error{
+		{Pos: token.Position{Offset: 3, Line: 1, Column: 4}, Message: "read error: boom"},
+	}, l.Errors())
+}
+
+func TestLexer_Number(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.Token
+	}{
+		{"42", []token.Token{{Type: token.INT, Literal: "42"}}},
+		{"1.5", []token.Token{{Type: token.FLOAT, Literal: "1.5"}}},
+		{"2e-3", []token.Token{{Type: token.FLOAT, Literal: "2e-3"}}},
+		{"6.02E+23", []token.Token{{Type: token.FLOAT, Literal: "6.02E+23"}}},
+		{"1e5", []token.Token{{Type: token.FLOAT, Literal: "1e5"}}},
+		{"1.", []token.Token{{Type: token.INT, Literal: "1"}, {Type: token.ILLEGAL, Literal: "."}}},
+		{"1e", []token.Token{{Type: token.INT, Literal: "1"}, {Type: token.IDENT, Literal: "e"}}},
+		{"1e+", []token.Token{{Type: token.INT, Literal: "1"}, {Type: token.IDENT, Literal: "e"}, {Type: token.PLUS, Literal: "+"}}},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		for _, expected := range tt.expected {
+			tok := l.NextToken()
+			assert.Equal(t, expected.Type, tok.Type, tt.input)
+			assert.Equal(t, expected.Literal, tok.Literal, tt.input)
+		}
+		assert.Equal(t, token.EOF, l.NextToken().Type, tt.input)
 	}
 }
@@ -0,0 +1,134 @@
+package lexer
+
+import (
+	"bytes"
+	"io"
+	"unicode/utf8"
+)
+
+const (
+	readChunkSize    = 4096
+	discardThreshold = 4096
+	lineContext      = 128 // lineで返す位置の前後のbyte数の上限
+)
+
+// source 入力を必要な分だけreaderから読み込んで保持する。offsetは全て入力の先頭からのbyte数
+type source struct {
+	r    io.Reader // 全て読み込み済みの場合はnil
+	buf  []byte
+	base int // buf[0]のoffset
+	err  error
+
+	midLine bool // 行の途中まで破棄している
+}
+
+func newStringSource(input string) *source {
+	return &source{buf: []byte(input)}
+}
+
+func newReaderSource(r io.Reader) *source {
+	return &source{r: r}
+}
+
+// end 読み込み済みの入力の終端のoffset
+func (s *source) end() int {
+	return s.base + len(s.buf)
+}
+
+// fill offsetの直前までを読み込む。入力がそれより短い場合はfalseを返す
+func (s *source) fill(offset int) bool {
+	for s.end() < offset && s.r != nil {
+		chunk := make([]byte, readChunkSize)
+		n, err := s.r.Read(chunk)
+		s.buf = append(s.buf, chunk[:n]...)
+		if err != nil {
+			if err != io.EOF {
+				s.err = err
+			}
+			s.r = nil
+		}
+	}
+	return s.end() >= offset
+}
+
+// decodeRune offsetの位置の文字とそのbyte数を返す。入力の終端では0を返す
+func (s *source) decodeRune(offset int) (rune, int) {
+	s.fill(offset + utf8.UTFMax)
+	if offset >= s.end() {
+		return 0, 0
+	}
+	return utf8.DecodeRune(s.buf[offset-s.base:])
+}
+
+// slice [start, end)を返す。破棄済みの部分と入力の終端より後ろは含まない
+func (s *source) slice(start, end int) string {
+	s.fill(end)
+	if start < s.base {
+		start = s.base
+	}
+	if end > s.end() {
+		end = s.end()
+	}
+	if start >= end {
+		return ""
+	}
+	return string(s.buf[start-s.base : end-s.base])
+}
+
+// rest startから入力の終端までを返す
+func (s *source) rest(start int) string {
+	for s.r != nil {
+		s.fill(s.end() + readChunkSize)
+	}
+	return s.slice(start, s.end())
+}
+
+// discard offsetより前の不要になった部分を捨てる。頻繁にコピーしないよう、ある程度溜まってから捨てる
+func (s *source) discard(offset int) {
+	if offset-s.base < discardThreshold {
+		return
+	}
+	s.midLine = s.buf[offset-s.base-1] != '\n'
+	s.buf = append(s.buf[:0], s.buf[offset-s.base:]...)
+	s.base = offset
+}
+
+// line offsetを含む行を改行を除いて返す。offsetの前後がlineContextより長い場合は省略し、省略した側に"..."を付ける
+// prefixは返した行のうちoffsetより前の文字数。破棄済みの行の場合は空文字を返す
+func (s *source) line(offset int) (line string, prefix int) {
+	if offset < s.base {
+		return "", 0
+	}
+	s.fill(offset + lineContext + 1)
+	if offset > s.end() {
+		offset = s.end()
+	}
+	buf := s.buf[:offset-s.base]
+	head := ""
+	if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+		buf = buf[i+1:]
+	} else if s.midLine {
+		head = "..."
+	}
+	if len(buf) > lineContext {
+		buf = buf[len(buf)-lineContext:]
+		head = "..."
+	}
+	for len(buf) > 0 && !utf8.RuneStart(buf[0]) {
+		buf = buf[1:]
+	}
+
+	rest := s.buf[offset-s.base:]
+	tail := ""
+	if i := bytes.IndexByte(rest, '\n'); i >= 0 && i <= lineContext {
+		rest = bytes.TrimSuffix(rest[:i], []byte("\r"))
+	} else if len(rest) > lineContext {
+		rest = rest[:lineContext]
+		for len(rest) > 0 && !utf8.RuneStart(s.buf[offset-s.base+len(rest)]) {
+			rest = rest[:len(rest)-1]
+		}
+		tail = "..."
+	}
+	line = head + string(buf) + string(rest) + tail
+	return line, utf8.RuneCountInString(head) + utf8.RuneCount(buf)
+}
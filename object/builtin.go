@@ -0,0 +1,202 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxRoundDigits roundの桁数の上限。10 ** 308はfloat64で表せる最大の10の累乗
+const maxRoundDigits = 308
+
+// Builtins evaluatorとvmで共有するbuiltin関数。vmはこの並び順をindexとして参照する
+var Builtins = []struct {
+	Name    string
+	Builtin *Builtin
+}{
+	{
+		Name: "len",
+		Builtin: &Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of argument. got=%d, want=1", len(args))
+				}
+				switch arg := args[0].(type) {
+				case *Array:
+					return &Integer{Value: int64(len(arg.Elements))}
+				case *String:
+					// 文字列はbyte数を返す。文字数はruneLenで得る
+					return &Integer{Value: int64(len(arg.Value))}
+				}
+				return newError("unsupported len.")
+			},
+		},
+	},
+	{
+		Name: "puts",
+		Builtin: &Builtin{
+			Fn: func(args ...Object) Object {
+				for _, arg := range args {
+					fmt.Println(arg.Inspect())
+				}
+				return nil
+			},
+		},
+	},
+	{
+		Name: "runeLen",
+		Builtin: &Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of argument. got=%d, want=1", len(args))
+				}
+				if arg, ok := args[0].(*String); ok {
+					return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+				}
+				return newError("unsupported runeLen. got=%s", args[0].Type())
+			},
+		},
+	},
+	{
+		Name: "int",
+		Builtin: &Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of argument. got=%d, want=1", len(args))
+				}
+				switch arg := args[0].(type) {
+				case *Integer, *BigInt:
+					return arg
+				case *Float:
+					// 0方向に切り捨てる
+					return floatToInteger(math.Trunc(arg.Value))
+				case *String:
+					i, ok := new(big.Int).SetString(strings.TrimSpace(arg.Value), 10)
+					if !ok {
+						return newError("cannot convert %q to INTEGER", arg.Value)
+					}
+					return NewInteger(i)
+				}
+				return newError("unsupported int. got=%s", args[0].Type())
+			},
+		},
+	},
+	{
+		Name: "float",
+		Builtin: &Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of argument. got=%d, want=1", len(args))
+				}
+				switch arg := args[0].(type) {
+				case *Integer, *BigInt:
+					f, _ := ToFloat64(arg)
+					return &Float{Value: f}
+				case *Float:
+					return arg
+				case *String:
+					f, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+					if err != nil {
+						return newError("cannot convert %q to FLOAT", arg.Value)
+					}
+					return &Float{Value: f}
+				}
+				return newError("unsupported float. got=%s", args[0].Type())
+			},
+		},
+	},
+	{
+		Name: "round",
+		Builtin: &Builtin{
+			// round(x)は最も近い整数(INTEGER)、round(x, digits)は小数点以下digits桁に丸めたFLOATを返す。0.5は0から遠い方に丸める
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 && len(args) != 2 {
+					return newError("wrong number of argument. got=%d, want=1 or 2", len(args))
+				}
+				x, ok := ToFloat64(args[0])
+				if !ok {
+					return newError("unsupported round. got=%s", args[0].Type())
+				}
+				if len(args) == 1 {
+					if args[0].Type() == INTEGER {
+						return args[0]
+					}
+					return floatToInteger(math.Round(x))
+				}
+				digits, ok := args[1].(*Integer)
+				if !ok {
+					return newError("unsupported round digits. got=%s", args[1].Type())
+				}
+				// 10 ** digitsがfloat64に収まらない桁数では、丸めても値が変わらないか0になる
+				switch {
+				case digits.Value > maxRoundDigits:
+					return &Float{Value: x}
+				case digits.Value < -maxRoundDigits:
+					return &Float{Value: math.Copysign(0, x)}
+				}
+				scale := math.Pow(10, float64(digits.Value))
+				scaled := x * scale
+				if math.IsInf(scaled, 0) {
+					// xが大きいため、小数点以下digits桁に丸めても値は変わらない
+					return &Float{Value: x}
+				}
+				return &Float{Value: math.Round(scaled) / scale}
+			},
+		},
+	},
+	{
+		Name: "floor",
+		Builtin: &Builtin{
+			Fn: func(args ...Object) Object {
+				return roundingBuiltin("floor", math.Floor, args)
+			},
+		},
+	},
+	{
+		Name: "ceil",
+		Builtin: &Builtin{
+			Fn: func(args ...Object) Object {
+				return roundingBuiltin("ceil", math.Ceil, args)
+			},
+		},
+	},
+}
+
+// roundingBuiltin FLOATをfnで丸めてINTEGERを返す
+func roundingBuiltin(name string, fn func(float64) float64, args []Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of argument. got=%d, want=1", len(args))
+	}
+	switch arg := args[0].(type) {
+	case *Integer, *BigInt:
+		return arg
+	case *Float:
+		return floatToInteger(fn(arg.Value))
+	}
+	return newError("unsupported %s. got=%s", name, args[0].Type())
+}
+
+// floatToInteger 整数値のfloat64をINTEGERにする。int64に収まらない場合は多倍長整数になる
+func floatToInteger(f float64) Object {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return newError("cannot convert %s to INTEGER", (&Float{Value: f}).Inspect())
+	}
+	i, _ := new(big.Float).SetFloat64(f).Int(nil)
+	return NewInteger(i)
+}
+
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+	return nil
+}
+
+func newError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
@@ -0,0 +1,555 @@
+package object
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+)
+
+// GoTagName 構造体をHashに変換する際のキー名を指定するタグ。"-"を指定したフィールドは無視する
+const GoTagName = "monkey"
+
+var (
+	objectType = reflect.TypeOf((*Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	bigIntType = reflect.TypeOf((*big.Int)(nil))
+)
+
+// FromGo Goの値をObjectに変換する。
+// nil, bool, 整数, string, slice, array, map, 構造体(タグ指定可), ポインタ, 関数に対応する
+func FromGo(v interface{}) (Object, error) {
+	if v == nil {
+		return NullObject, nil
+	}
+	if obj, ok := v.(Object); ok {
+		return obj, nil
+	}
+	return fromGoValue(reflect.ValueOf(v), make(map[goValueKey]bool))
+}
+
+// goValueKey 変換している途中のmap, slice, ポインタの識別子。
+// 同じアドレスでも型や長さが異なれば別の値として扱う
+type goValueKey struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// fromGoValue visitingは変換している途中の値。自身を含む値はErrCyclicValueを返す
+func fromGoValue(rv reflect.Value, visiting map[goValueKey]bool) (Object, error) {
+	if !rv.IsValid() {
+		return NullObject, nil
+	}
+	if rv.Type().Implements(objectType) {
+		if rv.Kind() == reflect.Pointer && rv.IsNil() {
+			return NullObject, nil
+		}
+		return rv.Interface().(Object), nil
+	}
+	if rv.Type() == bigIntType {
+		if rv.IsNil() {
+			return NullObject, nil
+		}
+		return NewInteger(new(big.Int).Set(rv.Interface().(*big.Int))), nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		if rv.Bool() {
+			return TrueObject, nil
+		}
+		return FalseObject, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Integer{Value: rv.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return NewInteger(new(big.Int).SetUint64(rv.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return &Float{Value: rv.Float()}, nil
+	case reflect.String:
+		return &String{Value: rv.String()}, nil
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return NullObject, nil
+		}
+		key := goValueKey{ptr: rv.Pointer(), typ: rv.Type()}
+		if visiting[key] {
+			return nil, ErrCyclicValue
+		}
+		visiting[key] = true
+		defer delete(visiting, key)
+		return fromGoValue(rv.Elem(), visiting)
+	case reflect.Interface:
+		if rv.IsNil() {
+			return NullObject, nil
+		}
+		return fromGoValue(rv.Elem(), visiting)
+	case reflect.Slice:
+		if rv.IsNil() {
+			return NullObject, nil
+		}
+		key := goValueKey{ptr: rv.Pointer(), typ: rv.Type(), len: rv.Len()}
+		if visiting[key] {
+			return nil, ErrCyclicValue
+		}
+		visiting[key] = true
+		defer delete(visiting, key)
+		return fromGoList(rv, visiting)
+	case reflect.Array:
+		return fromGoList(rv, visiting)
+	case reflect.Map:
+		if rv.IsNil() {
+			return NullObject, nil
+		}
+		key := goValueKey{ptr: rv.Pointer(), typ: rv.Type()}
+		if visiting[key] {
+			return nil, ErrCyclicValue
+		}
+		visiting[key] = true
+		defer delete(visiting, key)
+		return fromGoMap(rv, visiting)
+	case reflect.Struct:
+		return fromGoStruct(rv, visiting)
+	case reflect.Func:
+		if rv.IsNil() {
+			return NullObject, nil
+		}
+		return WrapFunc(rv.Interface())
+	}
+	return nil, fmt.Errorf("unsupported go type: %s", rv.Type())
+}
+
+func fromGoList(rv reflect.Value, visiting map[goValueKey]bool) (Object, error) {
+	elements := make([]Object, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		e, err := fromGoValue(rv.Index(i), visiting)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, e)
+	}
+	return &Array{Elements: elements}, nil
+}
+
+func fromGoMap(rv reflect.Value, visiting map[goValueKey]bool) (Object, error) {
+	pairs := make(map[HashKey]HashPair, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		key, err := fromGoValue(iter.Key(), visiting)
+		if err != nil {
+			return nil, err
+		}
+		hashable, ok := key.(Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+		value, err := fromGoValue(iter.Value(), visiting)
+		if err != nil {
+			return nil, err
+		}
+		pairs[hashable.HashKey()] = HashPair{Key: key, Value: value}
+	}
+	return &Hash{Pairs: pairs}, nil
+}
+
+func fromGoStruct(rv reflect.Value, visiting map[goValueKey]bool) (Object, error) {
+	pairs := make(map[HashKey]HashPair)
+	for _, f := range reflect.VisibleFields(rv.Type()) {
+		name, ok := fieldName(f)
+		if !ok {
+			continue
+		}
+		field, err := rv.FieldByIndexErr(f.Index)
+		if err != nil {
+			// nilの埋め込みポインタを経由するフィールドは存在しないものとして扱う
+			continue
+		}
+		value, err := fromGoValue(field, visiting)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		key := &String{Value: name}
+		pairs[key.HashKey()] = HashPair{Key: key, Value: value}
+	}
+	return &Hash{Pairs: pairs}, nil
+}
+
+// fieldName Hashのキーとして使う名前を返す。変換対象外のフィールドの場合はfalse
+func fieldName(f reflect.StructField) (string, bool) {
+	if !f.IsExported() || f.Anonymous {
+		return "", false
+	}
+	tag := f.Tag.Get(GoTagName)
+	if tag == "-" {
+		return "", false
+	}
+	if name, _, _ := strings.Cut(tag, ","); name != "" {
+		return name, true
+	}
+	return f.Name, true
+}
+
+// ToGo ObjectをGoの値に変換する。
+// INTEGERはint64(int64に収まらない場合は*big.Int), FLOATはfloat64, ARRAYは[]interface{}, HASHはキーが全てSTRINGならmap[string]interface{}、それ以外はmap[interface{}]interface{}になる
+// 自身を含む配列やハッシュはErrCyclicValueを返す
+func ToGo(obj Object) (interface{}, error) {
+	return toGo(obj, make(map[Object]bool))
+}
+
+// toGo visitingは変換している途中の配列とハッシュ
+func toGo(obj Object, visiting map[Object]bool) (interface{}, error) {
+	switch obj := obj.(type) {
+	case nil, *Null:
+		return nil, nil
+	case *Integer:
+		return obj.Value, nil
+	case *BigInt:
+		return new(big.Int).Set(obj.Value), nil
+	case *Float:
+		return obj.Value, nil
+	case *String:
+		return obj.Value, nil
+	case *Boolean:
+		return obj.Value, nil
+	case *Array:
+		if visiting[obj] {
+			return nil, ErrCyclicValue
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		elements := make([]interface{}, 0, len(obj.Elements))
+		for _, e := range obj.Elements {
+			v, err := toGo(e, visiting)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, v)
+		}
+		return elements, nil
+	case *Hash:
+		if visiting[obj] {
+			return nil, ErrCyclicValue
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+		return hashToGo(obj, visiting)
+	}
+	return nil, fmt.Errorf("cannot convert %s to go value", obj.Type())
+}
+
+func hashToGo(hash *Hash, visiting map[Object]bool) (interface{}, error) {
+	stringKeys := true
+	for _, pair := range hash.Pairs {
+		if pair.Key.Type() != STRING {
+			stringKeys = false
+			break
+		}
+	}
+
+	if stringKeys {
+		m := make(map[string]interface{}, len(hash.Pairs))
+		for _, pair := range hash.Pairs {
+			v, err := toGo(pair.Value, visiting)
+			if err != nil {
+				return nil, err
+			}
+			m[pair.Key.(*String).Value] = v
+		}
+		return m, nil
+	}
+
+	m := make(map[interface{}]interface{}, len(hash.Pairs))
+	for _, pair := range hash.Pairs {
+		k, err := toGo(pair.Key, visiting)
+		if err != nil {
+			return nil, err
+		}
+		v, err := toGo(pair.Value, visiting)
+		if err != nil {
+			return nil, err
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+func isIntegerKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+// toGoValue Objectを指定された型のGoの値に変換する。visitingは変換している途中の配列とハッシュ
+func toGoValue(obj Object, typ reflect.Type, visiting map[Object]bool) (reflect.Value, error) {
+	if obj == nil {
+		obj = NullObject
+	}
+	if typ.Implements(objectType) && reflect.TypeOf(obj).AssignableTo(typ) {
+		return reflect.ValueOf(obj), nil
+	}
+	if typ == bigIntType {
+		if obj.Type() == NULL {
+			return reflect.Zero(typ), nil
+		}
+		if i, ok := ToBigInt(obj); ok {
+			return reflect.ValueOf(i), nil
+		}
+		return reflect.Value{}, fmt.Errorf("cannot use %s as %s", obj.Type(), typ)
+	}
+	if b, ok := obj.(*BigInt); ok && isIntegerKind(typ.Kind()) {
+		return reflect.Value{}, fmt.Errorf("integer %s overflows %s", b.Value, typ)
+	}
+
+	switch typ.Kind() {
+	case reflect.Interface:
+		v, err := toGo(obj, visiting)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if v == nil {
+			return reflect.Zero(typ), nil
+		}
+		rv := reflect.ValueOf(v)
+		if !rv.Type().AssignableTo(typ) {
+			return reflect.Value{}, fmt.Errorf("cannot use %s as %s", obj.Type(), typ)
+		}
+		return rv, nil
+	case reflect.Pointer:
+		if obj.Type() == NULL {
+			return reflect.Zero(typ), nil
+		}
+		elem, err := toGoValue(obj, typ.Elem(), visiting)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		ptr := reflect.New(typ.Elem())
+		ptr.Elem().Set(elem)
+		return ptr, nil
+	case reflect.Bool:
+		b, ok := obj.(*Boolean)
+		if !ok {
+			break
+		}
+		return reflect.ValueOf(b.Value).Convert(typ), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := obj.(*Integer)
+		if !ok {
+			break
+		}
+		rv := reflect.New(typ).Elem()
+		if rv.OverflowInt(i.Value) {
+			return reflect.Value{}, fmt.Errorf("integer %d overflows %s", i.Value, typ)
+		}
+		rv.SetInt(i.Value)
+		return rv, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, ok := obj.(*Integer)
+		if !ok {
+			break
+		}
+		rv := reflect.New(typ).Elem()
+		if i.Value < 0 || rv.OverflowUint(uint64(i.Value)) {
+			return reflect.Value{}, fmt.Errorf("integer %d overflows %s", i.Value, typ)
+		}
+		rv.SetUint(uint64(i.Value))
+		return rv, nil
+	case reflect.Float32, reflect.Float64:
+		// INTEGERも受け付ける
+		f, ok := ToFloat64(obj)
+		if !ok {
+			break
+		}
+		return reflect.ValueOf(f).Convert(typ), nil
+	case reflect.String:
+		s, ok := obj.(*String)
+		if !ok {
+			break
+		}
+		return reflect.ValueOf(s.Value).Convert(typ), nil
+	case reflect.Slice:
+		if obj.Type() == NULL {
+			return reflect.Zero(typ), nil
+		}
+		array, ok := obj.(*Array)
+		if !ok {
+			break
+		}
+		if visiting[array] {
+			return reflect.Value{}, ErrCyclicValue
+		}
+		visiting[array] = true
+		defer delete(visiting, array)
+
+		rv := reflect.MakeSlice(typ, len(array.Elements), len(array.Elements))
+		for i, e := range array.Elements {
+			ev, err := toGoValue(e, typ.Elem(), visiting)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("index %d: %w", i, err)
+			}
+			rv.Index(i).Set(ev)
+		}
+		return rv, nil
+	case reflect.Map:
+		if obj.Type() == NULL {
+			return reflect.Zero(typ), nil
+		}
+		hash, ok := obj.(*Hash)
+		if !ok {
+			break
+		}
+		if visiting[hash] {
+			return reflect.Value{}, ErrCyclicValue
+		}
+		visiting[hash] = true
+		defer delete(visiting, hash)
+
+		rv := reflect.MakeMapWithSize(typ, len(hash.Pairs))
+		for _, pair := range hash.Pairs {
+			k, err := toGoValue(pair.Key, typ.Key(), visiting)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v, err := toGoValue(pair.Value, typ.Elem(), visiting)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+			}
+			rv.SetMapIndex(k, v)
+		}
+		return rv, nil
+	case reflect.Struct:
+		hash, ok := obj.(*Hash)
+		if !ok {
+			break
+		}
+		if visiting[hash] {
+			return reflect.Value{}, ErrCyclicValue
+		}
+		visiting[hash] = true
+		defer delete(visiting, hash)
+
+		rv := reflect.New(typ).Elem()
+		for _, f := range reflect.VisibleFields(typ) {
+			name, ok := fieldName(f)
+			if !ok {
+				continue
+			}
+			pair, ok := hash.Pairs[(&String{Value: name}).HashKey()]
+			if !ok {
+				continue
+			}
+			v, err := toGoValue(pair.Value, f.Type, visiting)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("field %s: %w", f.Name, err)
+			}
+			field, ok := allocFieldByIndex(rv, f.Index)
+			if !ok {
+				return reflect.Value{}, fmt.Errorf("field %s: cannot allocate embedded pointer", f.Name)
+			}
+			field.Set(v)
+		}
+		return rv, nil
+	}
+	return reflect.Value{}, fmt.Errorf("cannot use %s as %s", obj.Type(), typ)
+}
+
+// allocFieldByIndex FieldByIndexと同じだが、経由するnilの埋め込みポインタには値を確保する。確保できない場合はfalse
+func allocFieldByIndex(rv reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && rv.Kind() == reflect.Pointer {
+			if rv.IsNil() {
+				if !rv.CanSet() {
+					return reflect.Value{}, false
+				}
+				rv.Set(reflect.New(rv.Type().Elem()))
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(x)
+	}
+	return rv, true
+}
+
+// WrapFunc 任意のGoの関数をBuiltinに変換する。
+// 引数は関数の型に合わせて変換され、戻り値は(), (T), (error), (T, error)のいずれかである必要がある。関数がpanicした場合はErrorを返す
+func WrapFunc(fn interface{}) (*Builtin, error) {
+	rv := reflect.ValueOf(fn)
+	if rv.Kind() != reflect.Func || rv.IsNil() {
+		return nil, fmt.Errorf("not a function: %T", fn)
+	}
+	typ := rv.Type()
+
+	returnsError := typ.NumOut() > 0 && typ.Out(typ.NumOut()-1) == errorType
+	switch {
+	case typ.NumOut() == 2 && returnsError, typ.NumOut() <= 1:
+	default:
+		return nil, fmt.Errorf("unsupported return values: %s", typ)
+	}
+
+	return &Builtin{Fn: func(args ...Object) Object {
+		in, err := funcArguments(typ, args)
+		if err != nil {
+			return newError("%s", err)
+		}
+
+		out, err := callFunc(rv, in)
+		if err != nil {
+			return newError("%s", err)
+		}
+		if returnsError {
+			if err, _ := out[len(out)-1].Interface().(error); err != nil {
+				return newError("%s", err)
+			}
+			out = out[:len(out)-1]
+		}
+		if len(out) == 0 {
+			return NullObject
+		}
+
+		result, err := fromGoValue(out[0], make(map[goValueKey]bool))
+		if err != nil {
+			return newError("%s", err)
+		}
+		return result
+	}}, nil
+}
+
+// callFunc 呼び出した関数のpanicをエラーとして返す
+func callFunc(fn reflect.Value, in []reflect.Value) (out []reflect.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn.Call(in), nil
+}
+
+func funcArguments(typ reflect.Type, args []Object) ([]reflect.Value, error) {
+	numIn := typ.NumIn()
+	if typ.IsVariadic() {
+		if len(args) < numIn-1 {
+			return nil, fmt.Errorf("wrong number of arguments: want>=%d, got=%d", numIn-1, len(args))
+		}
+	} else if len(args) != numIn {
+		return nil, fmt.Errorf("wrong number of arguments: want=%d, got=%d", numIn, len(args))
+	}
+
+	in := make([]reflect.Value, 0, len(args))
+	for i, arg := range args {
+		var paramType reflect.Type
+		if typ.IsVariadic() && i >= numIn-1 {
+			paramType = typ.In(numIn - 1).Elem()
+		} else {
+			paramType = typ.In(i)
+		}
+		v, err := toGoValue(arg, paramType, make(map[Object]bool))
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i, err)
+		}
+		in = append(in, v)
+	}
+	return in, nil
+}
@@ -0,0 +1,244 @@
+package object
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type user struct {
+	Name    string `monkey:"name"`
+	Age     int    `monkey:"age"`
+	Admin   bool
+	Ignored string `monkey:"-"`
+	secret  string
+}
+
+type inner struct {
+	X int
+}
+
+type outer struct {
+	*inner
+	*Inner
+	Y int
+}
+
+type Inner struct {
+	Z int
+}
+
+func TestFromGo(t *testing.T) {
+	for _, tt := range []struct {
+		input    interface{}
+		expected string
+	}{
+		{nil, "null"},
+		{1, "1"},
+		{uint8(2), "2"},
+		{"hoge", "hoge"},
+		{true, "true"},
+		{[]int{1, 2}, "[1, 2]"},
+		{[2]string{"a", "b"}, "[a, b]"},
+		{map[string]int{"a": 1}, "{a:1}"},
+		{&user{Name: "karamaru", Ignored: "x", secret: "y"}, "{Admin:false, age:0, name:karamaru}"},
+		{(*user)(nil), "null"},
+		{[]interface{}{1, "a", nil}, "[1, a, null]"},
+		{&Integer{Value: 3}, "3"},
+		{1.5, "1.5"},
+		{float32(2), "2.0"},
+	} {
+		obj, err := FromGo(tt.input)
+		assert.NoError(t, err)
+		if hash, ok := obj.(*Hash); ok {
+			assert.Equal(t, tt.expected, sortedInspect(hash))
+			continue
+		}
+		assert.Equal(t, tt.expected, obj.Inspect())
+	}
+
+	assert.Same(t, TrueObject, mustFromGo(t, true))
+	assert.Same(t, NullObject, mustFromGo(t, nil))
+
+	assert.Equal(t, &BigInt{Value: new(big.Int).SetUint64(1 << 63)}, mustFromGo(t, uint64(1<<63)))
+	assert.Equal(t, &Integer{Value: 5}, mustFromGo(t, big.NewInt(5)))
+
+	// nilの埋め込みポインタのフィールドは含まない
+	assert.Equal(t, "{Y:1}", sortedInspect(mustFromGo(t, outer{Y: 1}).(*Hash)))
+	assert.Equal(t, "{X:2, Y:1, Z:3}", sortedInspect(mustFromGo(t, outer{inner: &inner{X: 2}, Inner: &Inner{Z: 3}, Y: 1}).(*Hash)))
+
+	_, err := FromGo(map[[1]int]int{{1}: 1})
+	assert.EqualError(t, err, "unusable as hash key: ARRAY")
+	_, err = FromGo(make(chan int))
+	assert.EqualError(t, err, "unsupported go type: chan int")
+
+	// 自身を含むmap, slice, ポインタは変換できない
+	m := map[string]interface{}{}
+	m["self"] = m
+	_, err = FromGo(m)
+	assert.ErrorIs(t, err, ErrCyclicValue)
+	s := []interface{}{nil}
+	s[0] = s
+	_, err = FromGo(s)
+	assert.ErrorIs(t, err, ErrCyclicValue)
+	type node struct{ Next *node }
+	n := &node{}
+	n.Next = n
+	_, err = FromGo(n)
+	assert.ErrorIs(t, err, ErrCyclicValue)
+
+	// 同じ値を複数回含むだけであれば変換できる
+	shared := []int{1}
+	assert.Equal(t, "[[1], [1]]", mustFromGo(t, [][]int{shared, shared}).Inspect())
+	first := &node{}
+	assert.Equal(t, "[{Next:null}, {Next:null}]", mustFromGo(t, []*node{first, first}).Inspect())
+}
+
+func TestToGo(t *testing.T) {
+	hash, err := FromGo(map[string]interface{}{"a": []int{1}, "b": nil})
+	assert.NoError(t, err)
+	v, err := ToGo(hash)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"a": []interface{}{int64(1)}, "b": nil}, v)
+
+	hash, err = FromGo(map[int]string{1: "a"})
+	assert.NoError(t, err)
+	v, err = ToGo(hash)
+	assert.NoError(t, err)
+	assert.Equal(t, map[interface{}]interface{}{int64(1): "a"}, v)
+
+	v, err = ToGo(&BigInt{Value: new(big.Int).Lsh(big.NewInt(1), 64)})
+	assert.NoError(t, err)
+	assert.Equal(t, "18446744073709551616", v.(*big.Int).String())
+
+	v, err = ToGo(&Float{Value: 0.25})
+	assert.NoError(t, err)
+	assert.Equal(t, 0.25, v)
+
+	_, err = ToGo(&Closure{})
+	assert.EqualError(t, err, "cannot convert CLOSURE to go value")
+
+	// 自身を含む配列とハッシュは変換できない
+	array := &Array{Elements: []Object{NullObject}}
+	array.Elements[0] = &Hash{Pairs: map[HashKey]HashPair{}}
+	key := &String{Value: "a"}
+	array.Elements[0].(*Hash).Pairs[key.HashKey()] = HashPair{Key: key, Value: array}
+	_, err = ToGo(array)
+	assert.ErrorIs(t, err, ErrCyclicValue)
+
+	// 同じ配列を複数回含むだけであれば変換できる
+	shared := &Array{Elements: []Object{&Integer{Value: 1}}}
+	v, err = ToGo(&Array{Elements: []Object{shared, shared}})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{[]interface{}{int64(1)}, []interface{}{int64(1)}}, v)
+}
+
+func TestArray_InspectCyclic(t *testing.T) {
+	array := &Array{Elements: []Object{&Integer{Value: 1}, NullObject}}
+	array.Elements[1] = array
+	assert.Equal(t, "[1, [...]]", array.Inspect())
+
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	key := &String{Value: "self"}
+	hash.Pairs[key.HashKey()] = HashPair{Key: key, Value: &Array{Elements: []Object{hash}}}
+	assert.Equal(t, "{self:[{...}]}", hash.Inspect())
+}
+
+func TestWrapFunc(t *testing.T) {
+	add, err := WrapFunc(func(a, b int) int { return a + b })
+	assert.NoError(t, err)
+	assert.Equal(t, &Integer{Value: 3}, add.Fn(&Integer{Value: 1}, &Integer{Value: 2}))
+	assert.Equal(t, &Error{Message: "wrong number of arguments: want=2, got=1"}, add.Fn(&Integer{Value: 1}))
+	assert.Equal(t, &Error{Message: "argument 1: cannot use STRING as int"}, add.Fn(&Integer{Value: 1}, &String{Value: "a"}))
+
+	greet, err := WrapFunc(func(u user) (string, error) {
+		if u.Name == "" {
+			return "", errors.New("name is required")
+		}
+		return "hello " + u.Name, nil
+	})
+	assert.NoError(t, err)
+	arg, err := FromGo(map[string]interface{}{"name": "karamaru", "age": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, &String{Value: "hello karamaru"}, greet.Fn(arg))
+	assert.Equal(t, &Error{Message: "name is required"}, greet.Fn(&Hash{Pairs: map[HashKey]HashPair{}}))
+
+	sum, err := WrapFunc(func(prefix string, nums ...int8) string {
+		total := 0
+		for _, n := range nums {
+			total += int(n)
+		}
+		return prefix + string(rune('0'+total))
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &String{Value: "s6"}, sum.Fn(&String{Value: "s"}, &Integer{Value: 1}, &Integer{Value: 2}, &Integer{Value: 3}))
+	assert.Equal(t, &Error{Message: "argument 1: integer 1000 overflows int8"}, sum.Fn(&String{Value: "s"}, &Integer{Value: 1000}))
+
+	half, err := WrapFunc(func(f float32) float64 { return float64(f) / 2 })
+	assert.NoError(t, err)
+	assert.Equal(t, &Float{Value: 1.5}, half.Fn(&Float{Value: 3}))
+	assert.Equal(t, &Float{Value: 2}, half.Fn(&Integer{Value: 4}))
+
+	double, err := WrapFunc(func(i *big.Int) *big.Int { return i.Lsh(i, 1) })
+	assert.NoError(t, err)
+	assert.Equal(t, "9223372036854775808", double.Fn(&Integer{Value: 1 << 62}).Inspect())
+	assert.Equal(t, &Integer{Value: 2}, double.Fn(&Integer{Value: 1}))
+	big64 := &BigInt{Value: new(big.Int).Lsh(big.NewInt(1), 64)}
+	assert.Equal(t, &Error{Message: "argument 0: integer 18446744073709551616 overflows int"}, add.Fn(big64, &Integer{Value: 1}))
+
+	embedded, err := WrapFunc(func(o outer) int {
+		if o.Inner == nil {
+			return o.Y
+		}
+		return o.Y + o.Z
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &Integer{Value: 3}, embedded.Fn(mustFromGo(t, map[string]int{"Y": 1, "Z": 2})))
+	assert.Equal(t, &Integer{Value: 1}, embedded.Fn(mustFromGo(t, map[string]int{"Y": 1})))
+	assert.Equal(t, &Error{Message: "argument 0: field X: cannot allocate embedded pointer"}, embedded.Fn(mustFromGo(t, map[string]int{"X": 1})))
+
+	panics, err := WrapFunc(func(s []int) int { return s[1] })
+	assert.NoError(t, err)
+	assert.Equal(t, &Error{Message: "panic: runtime error: index out of range [1] with length 0"}, panics.Fn(&Array{}))
+
+	cyclic := &Array{Elements: []Object{NullObject}}
+	cyclic.Elements[0] = cyclic
+	count, err := WrapFunc(func(v []interface{}) int { return len(v) })
+	assert.NoError(t, err)
+	assert.Equal(t, &Error{Message: "argument 0: index 0: cyclic value"}, count.Fn(cyclic))
+
+	noop, err := WrapFunc(func(objs ...Object) {})
+	assert.NoError(t, err)
+	assert.Same(t, NullObject, noop.Fn(&Integer{Value: 1}))
+
+	_, err = WrapFunc(1)
+	assert.EqualError(t, err, "not a function: int")
+	_, err = WrapFunc(func() (int, int) { return 0, 0 })
+	assert.EqualError(t, err, "unsupported return values: func() (int, int)")
+}
+
+func mustFromGo(t *testing.T, v interface{}) Object {
+	t.Helper()
+	obj, err := FromGo(v)
+	assert.NoError(t, err)
+	return obj
+}
+
+func sortedInspect(h *Hash) string {
+	keys := make([]string, 0, len(h.Pairs))
+	values := make(map[string]string, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		keys = append(keys, pair.Key.Inspect())
+		values[pair.Key.Inspect()] = pair.Value.Inspect()
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+":"+values[k])
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
@@ -28,3 +28,15 @@ func (e *Environment) Set(key string, val Object) Object {
 	return val
 
 }
+
+// Assign keyが定義されたスコープの値を更新する。どのスコープにも定義されていなければfalseを返す
+func (e *Environment) Assign(key string, val Object) bool {
+	if _, ok := e.store[key]; ok {
+		e.store[key] = val
+		return true
+	}
+	if e.outer != nil {
+		return e.outer.Assign(key, val)
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package object
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrCanceled contextのキャンセルや期限切れで実行が中断されたことを表す。errors.Isで判定する
+var ErrCanceled = errors.New("execution canceled")
+
+// ErrDivisionByZero 0による除算・剰余で返される。errors.Isで判定する
+var ErrDivisionByZero = errors.New("division by zero")
+
+// ErrCyclicValue 自身を含む配列やハッシュ、Goのmapやポインタのように、参照が循環している値を変換しようとした場合に返される
+var ErrCyclicValue = errors.New("cyclic value")
+
+type CanceledError struct {
+	Err error // context.Context.Err()
+}
+
+func (e *CanceledError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrCanceled, e.Err)
+}
+
+func (e *CanceledError) Is(target error) bool {
+	return target == ErrCanceled
+}
+
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
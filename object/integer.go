@@ -0,0 +1,406 @@
+package object
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/big"
+	"math/bits"
+)
+
+// MaxIntegerBits 乗算、累乗、左シフトの結果のビット長の上限。計算する前に結果の大きさを見積もり、超える場合はエラーにする
+const MaxIntegerBits = 1 << 23
+
+// BigInt int64に収まらない整数。Typeは*Integerと同じINTEGERで、演算結果がint64に収まる場合は*Integerに戻る
+type BigInt struct {
+	Value *big.Int
+}
+
+func (b *BigInt) Type() Type {
+	return INTEGER
+}
+
+func (b *BigInt) Inspect() string {
+	return b.Value.String()
+}
+
+// HashKey 値が等しい*Integerと同じキーになるようにする
+func (b *BigInt) HashKey() HashKey {
+	if b.Value.IsInt64() {
+		return (&Integer{Value: b.Value.Int64()}).HashKey()
+	}
+	h := fnv.New64a()
+	h.Write([]byte{byte(b.Value.Sign() + 1)})
+	h.Write(b.Value.Bytes())
+	return HashKey{Type: INTEGER, Value: h.Sum64()}
+}
+
+// NewInteger vがint64に収まる場合は*Integer、収まらない場合は*BigIntを返す
+func NewInteger(v *big.Int) Object {
+	if v.IsInt64() {
+		return &Integer{Value: v.Int64()}
+	}
+	return &BigInt{Value: v}
+}
+
+// ToBigInt *Integerと*BigIntを*big.Intに変換する。返り値は新たに確保されたものなので変更してよい
+func ToBigInt(obj Object) (*big.Int, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return big.NewInt(obj.Value), true
+	case *BigInt:
+		return new(big.Int).Set(obj.Value), true
+	}
+	return nil, false
+}
+
+// AddIntegers 整数同士の加算。int64で桁あふれする場合は*BigIntで計算する
+func AddIntegers(left, right Object) Object {
+	l, lok := left.(*Integer)
+	r, rok := right.(*Integer)
+	if lok && rok {
+		sum := l.Value + r.Value
+		// 符号が同じ2数を足して符号が変わった場合は桁あふれしている
+		if (l.Value >= 0) == (r.Value >= 0) && (sum >= 0) != (l.Value >= 0) {
+			return bigOperation(left, right, (*big.Int).Add)
+		}
+		return &Integer{Value: sum}
+	}
+	return bigOperation(left, right, (*big.Int).Add)
+}
+
+func SubIntegers(left, right Object) Object {
+	l, lok := left.(*Integer)
+	r, rok := right.(*Integer)
+	if lok && rok {
+		diff := l.Value - r.Value
+		if (l.Value >= 0) != (r.Value >= 0) && (diff >= 0) != (l.Value >= 0) {
+			return bigOperation(left, right, (*big.Int).Sub)
+		}
+		return &Integer{Value: diff}
+	}
+	return bigOperation(left, right, (*big.Int).Sub)
+}
+
+// MulIntegers 結果のビット長がMaxIntegerBitsを超える場合は計算する前にエラーを返す
+func MulIntegers(left, right Object) (Object, error) {
+	l, lok := left.(*Integer)
+	r, rok := right.(*Integer)
+	if lok && rok {
+		if product, ok := mulInt64(l.Value, r.Value); ok {
+			return &Integer{Value: product}, nil
+		}
+	}
+	if n := MulBitLen(left, right); n > MaxIntegerBits {
+		return nil, fmt.Errorf("product too large: %d bits", n)
+	}
+	return bigOperation(left, right, (*big.Int).Mul), nil
+}
+
+// MulBitLen left * rightの結果のビット長の上限
+func MulBitLen(left, right Object) uint64 {
+	return uint64(bitLen(left)) + uint64(bitLen(right))
+}
+
+// DivIntegers 負の無限大方向に切り捨てる(-7 / 2 == -4)。rightが0の場合はErrDivisionByZeroを返す
+func DivIntegers(left, right Object) (Object, error) {
+	if isZero(right) {
+		return nil, ErrDivisionByZero
+	}
+	l, lok := left.(*Integer)
+	r, rok := right.(*Integer)
+	if lok && rok && !(l.Value == math.MinInt64 && r.Value == -1) {
+		q := l.Value / r.Value
+		if l.Value%r.Value != 0 && (l.Value < 0) != (r.Value < 0) {
+			q--
+		}
+		return &Integer{Value: q}, nil
+	}
+	q, _ := floorDivMod(left, right)
+	return NewInteger(q), nil
+}
+
+// ModIntegers 結果はrightと同じ符号になり、left == (left / right) * right + left % rightを満たす
+func ModIntegers(left, right Object) (Object, error) {
+	if isZero(right) {
+		return nil, ErrDivisionByZero
+	}
+	l, lok := left.(*Integer)
+	r, rok := right.(*Integer)
+	if lok && rok {
+		m := l.Value % r.Value
+		if m != 0 && (m < 0) != (r.Value < 0) {
+			m += r.Value
+		}
+		return &Integer{Value: m}, nil
+	}
+	_, m := floorDivMod(left, right)
+	return NewInteger(m), nil
+}
+
+// PowIntegers 指数が負の場合は*Floatを返す。0の負の累乗はErrDivisionByZeroになる
+func PowIntegers(left, right Object) (Object, error) {
+	if CompareIntegers(right, &Integer{Value: 0}) < 0 {
+		if isZero(left) {
+			return nil, ErrDivisionByZero
+		}
+		l, _ := ToFloat64(left)
+		r, _ := ToFloat64(right)
+		return &Float{Value: math.Pow(l, r)}, nil
+	}
+	l, lok := left.(*Integer)
+	r, rok := right.(*Integer)
+	if lok && rok {
+		if p, ok := powInt64(l.Value, r.Value); ok {
+			return &Integer{Value: p}, nil
+		}
+	}
+	if PowBitLen(left, right) > MaxIntegerBits {
+		return nil, fmt.Errorf("exponent too large: %s", right.Inspect())
+	}
+	base, _ := ToBigInt(left)
+	exp, _ := ToBigInt(right)
+	return NewInteger(base.Exp(base, exp, nil)), nil
+}
+
+// PowBitLen left ** rightの結果のビット長の上限。rightが負の場合は0を返す
+func PowBitLen(left, right Object) uint64 {
+	base, _ := ToBigInt(left)
+	exp, _ := ToBigInt(right)
+	if exp.Sign() < 0 {
+		return 0
+	}
+	// 0, 1, -1の累乗は大きくならない
+	if base.CmpAbs(big.NewInt(1)) <= 0 {
+		return 1
+	}
+	if !exp.IsUint64() {
+		return math.MaxUint64
+	}
+	hi, lo := bits.Mul64(uint64(base.BitLen()), exp.Uint64())
+	if hi != 0 {
+		return math.MaxUint64
+	}
+	return lo
+}
+
+func NegateInteger(obj Object) Object {
+	if i, ok := obj.(*Integer); ok && i.Value != math.MinInt64 {
+		return &Integer{Value: -i.Value}
+	}
+	v, _ := ToBigInt(obj)
+	return NewInteger(v.Neg(v))
+}
+
+// AndIntegers ビット演算は負の数を無限長の2の補数として扱う
+func AndIntegers(left, right Object) Object {
+	l, lok := left.(*Integer)
+	r, rok := right.(*Integer)
+	if lok && rok {
+		return &Integer{Value: l.Value & r.Value}
+	}
+	return bigOperation(left, right, (*big.Int).And)
+}
+
+func OrIntegers(left, right Object) Object {
+	l, lok := left.(*Integer)
+	r, rok := right.(*Integer)
+	if lok && rok {
+		return &Integer{Value: l.Value | r.Value}
+	}
+	return bigOperation(left, right, (*big.Int).Or)
+}
+
+func XorIntegers(left, right Object) Object {
+	l, lok := left.(*Integer)
+	r, rok := right.(*Integer)
+	if lok && rok {
+		return &Integer{Value: l.Value ^ r.Value}
+	}
+	return bigOperation(left, right, (*big.Int).Xor)
+}
+
+// NotInteger ~xは-x - 1と等しい
+func NotInteger(obj Object) Object {
+	if i, ok := obj.(*Integer); ok {
+		return &Integer{Value: ^i.Value}
+	}
+	v, _ := ToBigInt(obj)
+	return NewInteger(v.Not(v))
+}
+
+// ShiftLeftIntegers int64で桁あふれする場合は*BigIntになる。rightが負の場合はエラーを返す
+func ShiftLeftIntegers(left, right Object) (Object, error) {
+	n, err := shiftCount(right)
+	if err != nil {
+		return nil, err
+	}
+	// 0はどれだけシフトしても0になる
+	if isZero(left) {
+		return &Integer{Value: 0}, nil
+	}
+	if l, ok := left.(*Integer); ok && n < 63 {
+		if shifted := l.Value << n; shifted>>n == l.Value {
+			return &Integer{Value: shifted}, nil
+		}
+	}
+	if ShiftLeftBitLen(left, right) > MaxIntegerBits {
+		return nil, fmt.Errorf("shift count too large: %s", right.Inspect())
+	}
+	v, _ := ToBigInt(left)
+	return NewInteger(v.Lsh(v, n)), nil
+}
+
+// ShiftLeftBitLen left << rightの結果のビット長。rightが負の場合は0を返す
+func ShiftLeftBitLen(left, right Object) uint64 {
+	v, _ := ToBigInt(left)
+	n, _ := ToBigInt(right)
+	if v.Sign() == 0 || n.Sign() < 0 {
+		return 0
+	}
+	if !n.IsUint64() || n.Uint64() > math.MaxUint64-uint64(v.BitLen()) {
+		return math.MaxUint64
+	}
+	return uint64(v.BitLen()) + n.Uint64()
+}
+
+// ShiftRightIntegers 算術シフト。負の数は負の無限大方向に丸められる(-5 >> 1 == -3)
+func ShiftRightIntegers(left, right Object) (Object, error) {
+	n, err := shiftCount(right)
+	if err != nil {
+		return nil, err
+	}
+	if l, ok := left.(*Integer); ok {
+		if n > 63 {
+			n = 63
+		}
+		return &Integer{Value: l.Value >> n}, nil
+	}
+	v, _ := ToBigInt(left)
+	// ビット長以上シフトすると0か-1になる
+	if n > uint(v.BitLen()) {
+		n = uint(v.BitLen())
+	}
+	return NewInteger(v.Rsh(v, n)), nil
+}
+
+// CompareIntegers left < rightなら-1、left == rightなら0、left > rightなら1を返す
+func CompareIntegers(left, right Object) int {
+	l, lok := left.(*Integer)
+	r, rok := right.(*Integer)
+	if lok && rok {
+		switch {
+		case l.Value < r.Value:
+			return -1
+		case l.Value > r.Value:
+			return 1
+		}
+		return 0
+	}
+	lv, _ := ToBigInt(left)
+	rv, _ := ToBigInt(right)
+	return lv.Cmp(rv)
+}
+
+func bigOperation(left, right Object, op func(z, x, y *big.Int) *big.Int) Object {
+	l, _ := ToBigInt(left)
+	r, _ := ToBigInt(right)
+	return NewInteger(op(l, l, r))
+}
+
+// floorDivMod 負の無限大方向に切り捨てた商と余りを返す
+func floorDivMod(left, right Object) (*big.Int, *big.Int) {
+	l, _ := ToBigInt(left)
+	r, _ := ToBigInt(right)
+	q, m := l.QuoRem(l, r, new(big.Int))
+	if m.Sign() != 0 && m.Sign() != r.Sign() {
+		q.Sub(q, big.NewInt(1))
+		m.Add(m, r)
+	}
+	return q, m
+}
+
+// shiftCount 負のシフト量はエラーにする。int64に収まらないシフト量はmath.MaxInt64として扱う。
+// 左シフトの結果が大きすぎる場合はMaxIntegerBitsで弾かれる
+func shiftCount(obj Object) (uint, error) {
+	if CompareIntegers(obj, &Integer{Value: 0}) < 0 {
+		return 0, fmt.Errorf("negative shift count: %s", obj.Inspect())
+	}
+	i, ok := obj.(*Integer)
+	if !ok {
+		return math.MaxInt64, nil
+	}
+	return uint(i.Value), nil
+}
+
+// bitLen 絶対値のビット長。*big.Intを複製しないで求める
+func bitLen(obj Object) int {
+	switch obj := obj.(type) {
+	case *Integer:
+		if obj.Value < 0 {
+			return bits.Len64(uint64(-(obj.Value + 1)) + 1)
+		}
+		return bits.Len64(uint64(obj.Value))
+	case *BigInt:
+		return obj.Value.BitLen()
+	}
+	return 0
+}
+
+func isZero(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Integer:
+		return obj.Value == 0
+	case *BigInt:
+		return obj.Value.Sign() == 0
+	}
+	return false
+}
+
+func powInt64(base, exp int64) (int64, bool) {
+	result := int64(1)
+	for exp > 0 {
+		if exp&1 == 1 {
+			var ok bool
+			if result, ok = mulInt64(result, base); !ok {
+				return 0, false
+			}
+		}
+		exp >>= 1
+		if exp > 0 {
+			var ok bool
+			if base, ok = mulInt64(base, base); !ok {
+				return 0, false
+			}
+		}
+	}
+	return result, true
+}
+
+func mulInt64(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	neg := (a < 0) != (b < 0)
+	hi, lo := bits.Mul64(absUint64(a), absUint64(b))
+	if hi != 0 {
+		return 0, false
+	}
+	if neg {
+		if lo > 1<<63 {
+			return 0, false
+		}
+		return int64(-lo), true
+	}
+	if lo > math.MaxInt64 {
+		return 0, false
+	}
+	return int64(lo), true
+}
+
+func absUint64(v int64) uint64 {
+	if v < 0 {
+		return uint64(-v)
+	}
+	return uint64(v)
+}
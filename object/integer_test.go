@@ -0,0 +1,150 @@
+package object
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntegerOperations(t *testing.T) {
+	bigInt := func(s string) Object {
+		v, _ := new(big.Int).SetString(s, 10)
+		return &BigInt{Value: v}
+	}
+
+	for _, tt := range []struct {
+		result   Object
+		expected Object
+	}{
+		{AddIntegers(&Integer{Value: 1}, &Integer{Value: 2}), &Integer{Value: 3}},
+		{AddIntegers(&Integer{Value: math.MaxInt64}, &Integer{Value: 1}), bigInt("9223372036854775808")},
+		{AddIntegers(&Integer{Value: math.MinInt64}, &Integer{Value: -1}), bigInt("-9223372036854775809")},
+		{AddIntegers(bigInt("9223372036854775808"), &Integer{Value: -1}), &Integer{Value: math.MaxInt64}},
+		{SubIntegers(&Integer{Value: math.MinInt64}, &Integer{Value: 1}), bigInt("-9223372036854775809")},
+		{SubIntegers(&Integer{Value: 0}, &Integer{Value: math.MinInt64}), bigInt("9223372036854775808")},
+		{SubIntegers(&Integer{Value: -1}, &Integer{Value: math.MaxInt64}), &Integer{Value: math.MinInt64}},
+		{NegateInteger(&Integer{Value: math.MinInt64}), bigInt("9223372036854775808")},
+		{NegateInteger(bigInt("9223372036854775808")), &Integer{Value: math.MinInt64}},
+		{AndIntegers(&Integer{Value: -1}, &Integer{Value: 6}), &Integer{Value: 6}},
+		{AndIntegers(bigInt("-18446744073709551616"), &Integer{Value: -1}), bigInt("-18446744073709551616")},
+		{OrIntegers(bigInt("18446744073709551616"), &Integer{Value: 1}), bigInt("18446744073709551617")},
+		{XorIntegers(bigInt("18446744073709551617"), bigInt("18446744073709551616")), &Integer{Value: 1}},
+		{NotInteger(&Integer{Value: 5}), &Integer{Value: -6}},
+		{NotInteger(bigInt("-9223372036854775809")), bigInt("9223372036854775808")},
+	} {
+		assert.Equal(t, tt.expected, tt.result)
+	}
+
+	assert.Equal(t, -1, CompareIntegers(&Integer{Value: math.MaxInt64}, bigInt("9223372036854775808")))
+	assert.Equal(t, 1, CompareIntegers(&Integer{Value: math.MinInt64}, bigInt("-9223372036854775809")))
+	assert.Equal(t, 0, CompareIntegers(bigInt("18446744073709551616"), bigInt("18446744073709551616")))
+}
+
+func TestIntegerDivision(t *testing.T) {
+	bigInt := func(s string) Object {
+		v, _ := new(big.Int).SetString(s, 10)
+		return &BigInt{Value: v}
+	}
+	lsh := func(x int64, n uint) Object { return &BigInt{Value: new(big.Int).Lsh(big.NewInt(x), n)} }
+	mul := func(l, r Object) (Object, error) { return MulIntegers(l, r) }
+	div := func(l, r Object) (Object, error) { return DivIntegers(l, r) }
+	mod := func(l, r Object) (Object, error) { return ModIntegers(l, r) }
+	pow := func(l, r Object) (Object, error) { return PowIntegers(l, r) }
+	shl := func(l, r Object) (Object, error) { return ShiftLeftIntegers(l, r) }
+	shr := func(l, r Object) (Object, error) { return ShiftRightIntegers(l, r) }
+
+	for _, tt := range []struct {
+		op          func(l, r Object) (Object, error)
+		left, right Object
+		expected    Object
+		err         string
+	}{
+		{mul, &Integer{Value: -3}, &Integer{Value: 4}, &Integer{Value: -12}, ""},
+		{mul, &Integer{Value: math.MinInt64}, &Integer{Value: 1}, &Integer{Value: math.MinInt64}, ""},
+		{mul, &Integer{Value: math.MinInt64}, &Integer{Value: -1}, bigInt("9223372036854775808"), ""},
+		{mul, &Integer{Value: 1 << 32}, &Integer{Value: -(1 << 31)}, &Integer{Value: math.MinInt64}, ""},
+		{mul, &Integer{Value: 1 << 32}, &Integer{Value: 1 << 31}, bigInt("9223372036854775808"), ""},
+		{mul, bigInt("-9223372036854775809"), &Integer{Value: 0}, &Integer{Value: 0}, ""},
+		{mul, &Integer{Value: 3}, lsh(1, MaxIntegerBits-3), lsh(3, MaxIntegerBits-3), ""},
+		{mul, &Integer{Value: 3}, lsh(1, MaxIntegerBits-2), nil, "product too large: 8388609 bits"},
+		{mul, lsh(-1, MaxIntegerBits/2), lsh(1, MaxIntegerBits/2), nil, "product too large: 8388610 bits"},
+		{div, &Integer{Value: 7}, &Integer{Value: 2}, &Integer{Value: 3}, ""},
+		{div, &Integer{Value: -7}, &Integer{Value: 2}, &Integer{Value: -4}, ""},
+		{div, &Integer{Value: 7}, &Integer{Value: -2}, &Integer{Value: -4}, ""},
+		{div, &Integer{Value: -8}, &Integer{Value: 2}, &Integer{Value: -4}, ""},
+		{div, &Integer{Value: math.MinInt64}, &Integer{Value: -1}, bigInt("9223372036854775808"), ""},
+		{div, bigInt("-18446744073709551617"), &Integer{Value: 1 << 32}, &Integer{Value: -4294967297}, ""},
+		{div, &Integer{Value: 1}, &Integer{Value: 0}, nil, "division by zero"},
+		{mod, &Integer{Value: 7}, &Integer{Value: 3}, &Integer{Value: 1}, ""},
+		{mod, &Integer{Value: -7}, &Integer{Value: 3}, &Integer{Value: 2}, ""},
+		{mod, &Integer{Value: 7}, &Integer{Value: -3}, &Integer{Value: -2}, ""},
+		{mod, &Integer{Value: math.MinInt64}, &Integer{Value: -1}, &Integer{Value: 0}, ""},
+		{mod, bigInt("-18446744073709551617"), &Integer{Value: 10}, &Integer{Value: 3}, ""},
+		{mod, bigInt("18446744073709551616"), bigInt("0"), nil, "division by zero"},
+		{pow, &Integer{Value: 2}, &Integer{Value: 10}, &Integer{Value: 1024}, ""},
+		{pow, &Integer{Value: -3}, &Integer{Value: 3}, &Integer{Value: -27}, ""},
+		{pow, &Integer{Value: 5}, &Integer{Value: 0}, &Integer{Value: 1}, ""},
+		{pow, &Integer{Value: -2}, &Integer{Value: 63}, &Integer{Value: math.MinInt64}, ""},
+		{pow, &Integer{Value: 2}, &Integer{Value: 64}, bigInt("18446744073709551616"), ""},
+		{pow, &Integer{Value: 2}, &Integer{Value: -2}, &Float{Value: 0.25}, ""},
+		{pow, &Integer{Value: -1}, bigInt("18446744073709551617"), &Integer{Value: -1}, ""},
+		{pow, &Integer{Value: 0}, &Integer{Value: -1}, nil, "division by zero"},
+		{pow, &Integer{Value: 2}, bigInt("18446744073709551616"), nil, "exponent too large: 18446744073709551616"},
+		{pow, &Integer{Value: 2}, &Integer{Value: math.MaxInt64}, nil, "exponent too large: 9223372036854775807"},
+		{pow, &Integer{Value: 3}, &Integer{Value: 10000000}, nil, "exponent too large: 10000000"},
+		{pow, &Integer{Value: -1}, &Integer{Value: math.MaxInt64}, &Integer{Value: -1}, ""},
+		{shl, &Integer{Value: 1}, &Integer{Value: 62}, &Integer{Value: 1 << 62}, ""},
+		{shl, &Integer{Value: 1}, &Integer{Value: 64}, bigInt("18446744073709551616"), ""},
+		{shl, &Integer{Value: 2}, &Integer{Value: 62}, bigInt("9223372036854775808"), ""},
+		{shl, &Integer{Value: -1}, &Integer{Value: 63}, &Integer{Value: math.MinInt64}, ""},
+		{shl, &Integer{Value: 0}, &Integer{Value: 1000}, &Integer{Value: 0}, ""},
+		{shl, &Integer{Value: 1}, &Integer{Value: -1}, nil, "negative shift count: -1"},
+		{shl, &Integer{Value: 1}, bigInt("18446744073709551616"), nil, "shift count too large: 18446744073709551616"},
+		{shl, &Integer{Value: 1}, &Integer{Value: math.MaxInt64}, nil, "shift count too large: 9223372036854775807"},
+		{shl, &Integer{Value: 1}, &Integer{Value: MaxIntegerBits}, nil, "shift count too large: 8388608"},
+		{shl, &Integer{Value: 0}, &Integer{Value: math.MaxInt64}, &Integer{Value: 0}, ""},
+		{shl, &Integer{Value: 0}, bigInt("100000000000000000000"), &Integer{Value: 0}, ""},
+		{shl, bigInt("-18446744073709551616"), bigInt("100000000000000000000"), nil, "shift count too large: 100000000000000000000"},
+		{shr, &Integer{Value: 1}, bigInt("100000000000000000000"), &Integer{Value: 0}, ""},
+		{shr, &Integer{Value: -1}, bigInt("100000000000000000000"), &Integer{Value: -1}, ""},
+		{shr, bigInt("18446744073709551616"), bigInt("100000000000000000000"), &Integer{Value: 0}, ""},
+		{shr, bigInt("-18446744073709551616"), bigInt("100000000000000000000"), &Integer{Value: -1}, ""},
+		{shr, &Integer{Value: -1}, &Integer{Value: math.MaxInt64}, &Integer{Value: -1}, ""},
+		{shr, &Integer{Value: -5}, &Integer{Value: 1}, &Integer{Value: -3}, ""},
+		{shr, &Integer{Value: -5}, &Integer{Value: 100}, &Integer{Value: -1}, ""},
+		{shr, &Integer{Value: 5}, &Integer{Value: 100}, &Integer{Value: 0}, ""},
+		{shr, bigInt("18446744073709551616"), &Integer{Value: 1}, bigInt("9223372036854775808"), ""},
+		{shr, bigInt("-18446744073709551617"), &Integer{Value: 64}, &Integer{Value: -2}, ""},
+		{shr, &Integer{Value: 1}, bigInt("-18446744073709551616"), nil, "negative shift count: -18446744073709551616"},
+	} {
+		result, err := tt.op(tt.left, tt.right)
+		if tt.err != "" {
+			assert.EqualError(t, err, tt.err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expected, result)
+	}
+	_, err := DivIntegers(&Integer{Value: 1}, &Integer{Value: 0})
+	assert.ErrorIs(t, err, ErrDivisionByZero)
+}
+
+func TestPowBitLen(t *testing.T) {
+	assert.Equal(t, uint64(20), PowBitLen(&Integer{Value: 2}, &Integer{Value: 10}))
+	assert.Equal(t, uint64(1), PowBitLen(&Integer{Value: -1}, &Integer{Value: math.MaxInt64}))
+	assert.Equal(t, uint64(0), PowBitLen(&Integer{Value: 2}, &Integer{Value: -1}))
+	assert.Equal(t, uint64(math.MaxUint64), PowBitLen(&Integer{Value: math.MaxInt64}, &Integer{Value: math.MaxInt64}))
+}
+
+func TestIntegerHashKey(t *testing.T) {
+	// 等しい値は表現によらず同じキーになる
+	assert.Equal(t, (&Integer{Value: 5}).HashKey(), (&BigInt{Value: big.NewInt(5)}).HashKey())
+	assert.Equal(t, (&Integer{Value: 5}).HashKey(), (&Float{Value: 5}).HashKey())
+	two64 := new(big.Int).Lsh(big.NewInt(1), 64)
+	assert.Equal(t, (&BigInt{Value: two64}).HashKey(), (&Float{Value: math.Pow(2, 64)}).HashKey())
+
+	assert.NotEqual(t, (&BigInt{Value: two64}).HashKey(), (&BigInt{Value: new(big.Int).Neg(two64)}).HashKey())
+	assert.NotEqual(t, (&Float{Value: 0.5}).HashKey(), (&Integer{Value: 0}).HashKey())
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"math/big"
 	"strconv"
 	"strings"
 
@@ -34,6 +36,8 @@ const (
 	HASH
 	BUILTIN
 	COMPILED_FUNCTION
+	CLOSURE
+	FLOAT
 )
 
 func (typ Type) String() string {
@@ -60,10 +64,21 @@ func (typ Type) String() string {
 		return "BUILTIN"
 	case COMPILED_FUNCTION:
 		return "COMPILED_FUNCTION"
+	case CLOSURE:
+		return "CLOSURE"
+	case FLOAT:
+		return "FLOAT"
 	}
 	return "UNKNOWN"
 }
 
+// 真偽値とnullは同一性で比較されるため、evaluatorとvmはこのインスタンスを共有する
+var (
+	TrueObject  = &Boolean{Value: true}
+	FalseObject = &Boolean{Value: false}
+	NullObject  = &Null{}
+)
+
 type Integer struct {
 	Value int64
 }
@@ -80,6 +95,84 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: INTEGER, Value: uint64(i.Value)}
 }
 
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() Type {
+	return FLOAT
+}
+
+// Inspect 整数と区別できるよう、整数値の場合も小数点を付ける
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if strings.ContainsAny(s, ".eIN") {
+		return s
+	}
+	return s + ".0"
+}
+
+// HashKey 1 == 1.0のように等しい値が同じキーになるよう、整数値の場合はIntegerやBigIntと同じキーを返す
+func (f *Float) HashKey() HashKey {
+	if !math.IsInf(f.Value, 0) && f.Value == math.Trunc(f.Value) {
+		i, _ := new(big.Float).SetFloat64(f.Value).Int(nil)
+		return (&BigInt{Value: i}).HashKey()
+	}
+	return HashKey{Type: FLOAT, Value: math.Float64bits(f.Value)}
+}
+
+// ToFloat64 INTEGERとFLOATをfloat64に変換する。数値でない場合はfalseを返す
+func ToFloat64(obj Object) (float64, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value), true
+	case *Float:
+		return obj.Value, true
+	case *BigInt:
+		f, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return f, true
+	}
+	return 0, false
+}
+
+// IsFloatOperation 少なくとも一方がFLOATで、もう一方も数値であればfloat64で演算する
+func IsFloatOperation(left, right Object) bool {
+	if left.Type() != FLOAT && right.Type() != FLOAT {
+		return false
+	}
+	_, lok := ToFloat64(left)
+	_, rok := ToFloat64(right)
+	return lok && rok
+}
+
+// DivFloats 0による除算は±Infにせず、ErrDivisionByZeroを返す
+func DivFloats(left, right float64) (float64, error) {
+	if right == 0 {
+		return 0, ErrDivisionByZero
+	}
+	return left / right, nil
+}
+
+// ModFloats 整数の剰余と同じく、結果はrightと同じ符号になる
+func ModFloats(left, right float64) (float64, error) {
+	if right == 0 {
+		return 0, ErrDivisionByZero
+	}
+	m := math.Mod(left, right)
+	if m != 0 && (m < 0) != (right < 0) {
+		m += right
+	}
+	return m, nil
+}
+
+// PowFloats 0の負の累乗は±Infにせず、ErrDivisionByZeroを返す
+func PowFloats(left, right float64) (float64, error) {
+	if left == 0 && right < 0 {
+		return 0, ErrDivisionByZero
+	}
+	return math.Pow(left, right), nil
+}
+
 type String struct {
 	Value string
 }
@@ -188,10 +281,21 @@ func (a *Array) Type() Type {
 }
 
 func (a *Array) Inspect() string {
+	return a.inspect(make(map[Object]bool))
+}
+
+// inspect visitingは表示している途中の配列とハッシュ。自身を含む場合は[...]と表示する
+func (a *Array) inspect(visiting map[Object]bool) string {
+	if visiting[a] {
+		return "[...]"
+	}
+	visiting[a] = true
+	defer delete(visiting, a)
+
 	var out bytes.Buffer
 	elements := make([]string, 0)
 	for _, e := range a.Elements {
-		elements = append(elements, e.Inspect())
+		elements = append(elements, inspectElement(e, visiting))
 	}
 	out.WriteString("[")
 	out.WriteString(strings.Join(elements, ", "))
@@ -218,10 +322,21 @@ func (h *Hash) Type() Type {
 }
 
 func (h *Hash) Inspect() string {
+	return h.inspect(make(map[Object]bool))
+}
+
+// inspect 自身を含む場合は{...}と表示する
+func (h *Hash) inspect(visiting map[Object]bool) string {
+	if visiting[h] {
+		return "{...}"
+	}
+	visiting[h] = true
+	defer delete(visiting, h)
+
 	var out bytes.Buffer
 	pairs := make([]string, 0, len(h.Pairs))
 	for _, pair := range h.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s:%s", pair.Key.Inspect(), pair.Value.Inspect()))
+		pairs = append(pairs, fmt.Sprintf("%s:%s", pair.Key.Inspect(), inspectElement(pair.Value, visiting)))
 	}
 	out.WriteString("{")
 	out.WriteString(strings.Join(pairs, ", "))
@@ -229,6 +344,17 @@ func (h *Hash) Inspect() string {
 	return out.String()
 }
 
+// inspectElement 配列とハッシュの要素を表示する。参照の循環を検出するためvisitingを引き継ぐ
+func inspectElement(obj Object, visiting map[Object]bool) string {
+	switch obj := obj.(type) {
+	case *Array:
+		return obj.inspect(visiting)
+	case *Hash:
+		return obj.inspect(visiting)
+	}
+	return obj.Inspect()
+}
+
 type BuiltinFunction func(args ...Object) Object
 
 type Builtin struct {
@@ -244,7 +370,11 @@ func (b *Builtin) Inspect() string {
 }
 
 type CompiledFunction struct {
-	Instructions code.Instructions
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+	Name          string // letで束縛された名前。無名関数の場合は空
+	SourceMap     code.SourceMap
 }
 
 func (c *CompiledFunction) Type() Type {
@@ -254,3 +384,16 @@ func (c *CompiledFunction) Type() Type {
 func (c *CompiledFunction) Inspect() string {
 	return fmt.Sprintf("CompoledFunction[%p]", c)
 }
+
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (c *Closure) Type() Type {
+	return CLOSURE
+}
+
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
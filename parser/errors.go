@@ -0,0 +1,98 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/karamaru-alpha/monkey/token"
+)
+
+// ParseError 構文エラー。Expectedが空の場合は、Actualのトークンがその位置に置けないことを表す
+// 字句解析のエラーの場合はActualは空になる
+type ParseError struct {
+	Pos      token.Position
+	Expected []token.Type
+	Actual   token.Token
+	Message  string
+	Line     string // Posを含むソースの行。長い行は前後が"..."で省略される
+
+	LineColumn int // Lineの先頭の文字の列。0の場合は1として扱う
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+// Snippet エラーの位置をキャレットで示したソースの抜粋を返す。キャレットは端末での表示幅に合わせて字下げする
+func (e *ParseError) Snippet() string {
+	var out bytes.Buffer
+	out.WriteString(e.Line)
+	out.WriteString("\n")
+	column := e.LineColumn
+	if column < 1 {
+		column = 1
+	}
+	for _, ch := range e.Line {
+		if column >= e.Pos.Column {
+			break
+		}
+		if ch == '\t' {
+			out.WriteByte('\t')
+		} else {
+			out.WriteString(strings.Repeat(" ", runeWidth(ch)))
+		}
+		column++
+	}
+	out.WriteString("^")
+	return out.String()
+}
+
+// wideRanges East Asian WidthがW(Wide)またはF(Fullwidth)の主な範囲。端末では2文字分の幅で表示される
+var wideRanges = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x1100, Hi: 0x115f, Stride: 1}, // Hangul Jamo
+		{Lo: 0x2e80, Hi: 0x303e, Stride: 1}, // CJK部首、CJKの記号と句読点
+		{Lo: 0x3041, Hi: 0x33ff, Stride: 1}, // ひらがな、カタカナ、CJK互換文字
+		{Lo: 0x3400, Hi: 0x4dbf, Stride: 1}, // CJK統合漢字拡張A
+		{Lo: 0x4e00, Hi: 0x9fff, Stride: 1}, // CJK統合漢字
+		{Lo: 0xa000, Hi: 0xa4cf, Stride: 1}, // Yi
+		{Lo: 0xa960, Hi: 0xa97f, Stride: 1}, // Hangul Jamo Extended-A
+		{Lo: 0xac00, Hi: 0xd7a3, Stride: 1}, // Hangul Syllables
+		{Lo: 0xf900, Hi: 0xfaff, Stride: 1}, // CJK互換漢字
+		{Lo: 0xfe10, Hi: 0xfe19, Stride: 1}, // 縦書き形
+		{Lo: 0xfe30, Hi: 0xfe6f, Stride: 1}, // CJK互換形、小字形
+		{Lo: 0xff00, Hi: 0xff60, Stride: 1}, // 全角英数字と記号
+		{Lo: 0xffe0, Hi: 0xffe6, Stride: 1}, // 全角記号
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1f300, Hi: 0x1f64f, Stride: 1}, // 絵文字
+		{Lo: 0x1f900, Hi: 0x1f9ff, Stride: 1}, // 補助絵文字
+		{Lo: 0x20000, Hi: 0x2fffd, Stride: 1}, // CJK統合漢字拡張B以降
+		{Lo: 0x30000, Hi: 0x3fffd, Stride: 1},
+	},
+}
+
+// runeWidth 端末で表示したときの幅。結合文字は0、全角文字は2として数える
+func runeWidth(ch rune) int {
+	switch {
+	case unicode.In(ch, unicode.Mn, unicode.Me):
+		return 0
+	case unicode.Is(wideRanges, ch):
+		return 2
+	default:
+		return 1
+	}
+}
+
+// ErrorList 1回のParseProgramで見つかった全ての構文エラー
+type ErrorList []*ParseError
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, 0, len(l))
+	for _, err := range l {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
@@ -2,6 +2,8 @@ package parser
 
 import (
 	"fmt"
+	"math/big"
+	"sort"
 	"strconv"
 
 	"github.com/karamaru-alpha/monkey/ast"
@@ -14,8 +16,13 @@ type prefixParseFn func() ast.Expression
 type infixParseFn func(left ast.Expression) ast.Expression
 
 type Parser struct {
-	lex    *lexer.Lexer
-	errors []error
+	lex        *lexer.Lexer
+	errors     ErrorList
+	panicking  bool // 文の途中でエラーが起きた後、同期するまで後続のエラーを報告しない
+	blockDepth int  // 解析中のブロックの深さ
+	comments   []token.Token
+
+	numLexerErrors int // 取り込み済みの字句解析のエラーの数
 
 	currentToken token.Token
 	peekToken    token.Token
@@ -30,9 +37,11 @@ func New(lex *lexer.Lexer) *Parser {
 	p.prefixParseFns = make(map[token.Type]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.TILDE, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
@@ -46,10 +55,22 @@ func New(lex *lexer.Lexer) *Parser {
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
 	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.POWER, p.parseInfixExpression)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.AMPERSAND, p.parseInfixExpression)
+	p.registerInfix(token.PIPE, p.parseInfixExpression)
+	p.registerInfix(token.CARET, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_LEFT, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_RIGHT, p.parseInfixExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 
@@ -61,6 +82,26 @@ func New(lex *lexer.Lexer) *Parser {
 func (p *Parser) nextToken() {
 	p.currentToken = p.peekToken
 	p.peekToken = p.lex.NextToken()
+	for p.peekToken.Type == token.COMMENT {
+		p.comments = append(p.comments, p.peekToken)
+		p.peekToken = p.lex.NextToken()
+	}
+	p.addLexerErrors()
+}
+
+// addLexerErrors 字句解析のエラーを取り込む。lexerがソースを破棄する前に行を取得する必要がある
+func (p *Parser) addLexerErrors() {
+	errs := p.lex.Errors()
+	for _, err := range errs[p.numLexerErrors:] {
+		line, column := p.lex.Line(err.Pos)
+		p.errors = append(p.errors, &ParseError{
+			Pos:        err.Pos,
+			Message:    err.Message,
+			Line:       line,
+			LineColumn: column,
+		})
+	}
+	p.numLexerErrors = len(errs)
 }
 
 func (p *Parser) registerPrefix(typ token.Type, fn prefixParseFn) {
@@ -71,21 +112,92 @@ func (p *Parser) registerInfix(typ token.Type, fn infixParseFn) {
 	p.infixParseFns[typ] = fn
 }
 
+// ParseProgram 構文エラーが起きた文は読み飛ばし、次の文から解析を続ける
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
 
 	for p.currentToken.Type != token.EOF {
+		numErrors := len(p.errors)
 		stmt := p.parseStatement()
-		if stmt != nil {
+		if p.panicking {
+			p.synchronize()
+		}
+		if stmt != nil && len(p.errors) == numErrors {
 			program.Statements = append(program.Statements, stmt)
 		}
 		p.nextToken()
 	}
+	program.Comments = p.comments
+
+	sort.SliceStable(p.errors, func(i, j int) bool {
+		return p.errors[i].Pos.Offset < p.errors[j].Pos.Offset
+	})
 
 	return program
 }
 
+// synchronize 文の区切りまでトークンを読み飛ばす。読み飛ばす途中で開いたブロックの中の区切りでは止まらない
+func (p *Parser) synchronize() {
+	p.panicking = false
+	depth := 0
+	for p.currentToken.Type != token.EOF {
+		switch p.currentToken.Type {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			depth--
+		}
+		if depth <= 0 {
+			if p.currentToken.Type == token.SEMICOLON {
+				return
+			}
+			switch p.peekToken.Type {
+			case token.LET, token.RETURN:
+				return
+			case token.RBRACE:
+				if p.blockDepth > 0 {
+					return
+				}
+			}
+		}
+		p.nextToken()
+	}
+}
+
+func (p *Parser) addError(tok token.Token, expected []token.Type, msg string) {
+	if p.panicking {
+		return
+	}
+	p.panicking = true
+	line, column := p.lex.Line(tok.Pos)
+	p.errors = append(p.errors, &ParseError{
+		Pos:        tok.Pos,
+		Expected:   expected,
+		Actual:     tok,
+		Message:    msg,
+		Line:       line,
+		LineColumn: column,
+	})
+}
+
+// expectPeek 次のトークンがtypであれば読み進める。そうでなければエラーを記録する
+func (p *Parser) expectPeek(typ token.Type) bool {
+	if p.peekToken.Type == typ {
+		p.nextToken()
+		return true
+	}
+	p.addError(p.peekToken, []token.Type{typ}, fmt.Sprintf("expected %s, got %s", typ, describe(p.peekToken)))
+	return false
+}
+
+func describe(tok token.Token) string {
+	if tok.Type == token.EOF || tok.Literal == "" {
+		return tok.Type.String()
+	}
+	return fmt.Sprintf("%s %q", tok.Type, tok.Literal)
+}
+
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.currentToken.Type {
 	case token.LET:
@@ -100,21 +212,20 @@ func (p *Parser) parseStatement() ast.Statement {
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: p.currentToken}
 
-	if p.peekToken.Type != token.IDENT {
-		p.errors = append(p.errors, fmt.Errorf("wrong token. expected: %s, actual: %s", token.IDENT, p.peekToken.Type))
+	if !p.expectPeek(token.IDENT) {
 		return nil
 	}
-	p.nextToken()
 	stmt.Name = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
 
-	if p.peekToken.Type != token.ASSIGN {
-		p.errors = append(p.errors, fmt.Errorf("wrong token. expected: %s, actual: %s", token.ASSIGN, p.peekToken.Type))
+	if !p.expectPeek(token.ASSIGN) {
 		return nil
 	}
-	p.nextToken()
 
 	p.nextToken()
 	stmt.Value = p.parseExpression(LOWEST)
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fl.Name = stmt.Name.Value
+	}
 
 	if p.peekToken.Type == token.SEMICOLON {
 		p.nextToken()
@@ -137,11 +248,19 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
 const (
 	LOWEST      = iota + 1
+	ASSIGNMENT  // x = y (右結合)
+	LOGICAL_OR  // ||
+	LOGICAL_AND // &&
 	EQUALS      // =
-	LESSGREATER // > or <
+	LESSGREATER // > or < or <= or >=
+	BIT_OR      // | (比較より強く結合する。flags & MASK == 0は(flags & MASK) == 0)
+	BIT_XOR     // ^
+	BIT_AND     // &
+	SHIFT       // << or >>
 	SUM         // +
-	PRODUCT     // *
-	PREFIX      // -x or !x
+	PRODUCT     // * / %
+	PREFIX      // -x or !x or ~x
+	POWER       // ** (右結合。-2 ** 2は-(2 ** 2))
 	CALL        // func(x)
 	INDEX       // [x]
 )
@@ -160,7 +279,7 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefix := p.prefixParseFns[p.currentToken.Type]
 	if prefix == nil {
-		p.errors = append(p.errors, fmt.Errorf("preFn is not registered. TokenType: %s", p.currentToken.Type))
+		p.addError(p.currentToken, nil, fmt.Sprintf("unexpected %s", describe(p.currentToken)))
 		return nil
 	}
 	leftExp := prefix()
@@ -185,8 +304,27 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.currentToken}
 
 	value, err := strconv.ParseInt(p.currentToken.Literal, 0, 64)
+	if err == nil {
+		lit.Value = value
+		return lit
+	}
+	// int64に収まらない場合は多倍長整数として扱う
+	v, ok := new(big.Int).SetString(p.currentToken.Literal, 0)
+	if !ok {
+		p.addError(p.currentToken, nil, fmt.Sprintf("could not parse %q as integer", p.currentToken.Literal))
+		return nil
+	}
+	lit.Big = v
+
+	return lit
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.currentToken}
+
+	value, err := strconv.ParseFloat(p.currentToken.Literal, 64)
 	if err != nil {
-		p.errors = append(p.errors, err)
+		p.addError(p.currentToken, nil, fmt.Sprintf("could not parse %q as float", p.currentToken.Literal))
 		return nil
 	}
 	lit.Value = value
@@ -205,16 +343,16 @@ func (p *Parser) parseBoolean() ast.Expression {
 func (p *Parser) parseGroupedExpression() ast.Expression {
 	p.nextToken()
 	exp := p.parseExpression(LOWEST)
-	if p.peekToken.Type != token.RPAREN {
+	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
-	p.nextToken()
 	return exp
 }
 
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	lit := &ast.ArrayLiteral{Token: p.currentToken}
 	lit.Elements = p.parseExpressionList(token.RBRACKET)
+	lit.Rbracket = p.currentToken
 	return lit
 }
 
@@ -226,20 +364,20 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		p.nextToken()
 		key := p.parseExpression(LOWEST)
 
-		if p.peekToken.Type != token.COLON {
+		if !p.expectPeek(token.COLON) {
 			return nil
 		}
-		p.nextToken()
 
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
 		hash.Pairs[key] = value
 
-		if p.peekToken.Type == token.COMMA {
-			p.nextToken()
+		if p.peekToken.Type != token.RBRACE && !p.expectPeek(token.COMMA) {
+			return nil
 		}
 	}
 	p.nextToken()
+	hash.Rbrace = p.currentToken
 	return hash
 }
 
@@ -259,10 +397,9 @@ func (p *Parser) parseExpressionList(end token.Type) []ast.Expression {
 		list = append(list, p.parseExpression(LOWEST))
 	}
 
-	if p.peekToken.Type != end {
+	if !p.expectPeek(end) {
 		return nil
 	}
-	p.nextToken()
 
 	return list
 }
@@ -277,16 +414,28 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 }
 
 var precedences = map[token.Type]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.ASTERISK: PRODUCT,
-	token.SLASH:    PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:      ASSIGNMENT,
+	token.EQ:          EQUALS,
+	token.NOT_EQ:      EQUALS,
+	token.LT:          LESSGREATER,
+	token.GT:          LESSGREATER,
+	token.LT_EQ:       LESSGREATER,
+	token.GT_EQ:       LESSGREATER,
+	token.AND:         LOGICAL_AND,
+	token.OR:          LOGICAL_OR,
+	token.PIPE:        BIT_OR,
+	token.CARET:       BIT_XOR,
+	token.AMPERSAND:   BIT_AND,
+	token.SHIFT_LEFT:  SHIFT,
+	token.SHIFT_RIGHT: SHIFT,
+	token.PLUS:        SUM,
+	token.MINUS:       SUM,
+	token.ASTERISK:    PRODUCT,
+	token.SLASH:       PRODUCT,
+	token.PERCENT:     PRODUCT,
+	token.POWER:       POWER,
+	token.LPAREN:      CALL,
+	token.LBRACKET:    INDEX,
 }
 
 func (p *Parser) currentPrecedence() int {
@@ -310,41 +459,60 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 		Left:     left,
 	}
 	precedence := p.currentPrecedence()
+	if p.currentToken.Type == token.POWER {
+		// 右結合にするため、同じ優先順位の演算子を右辺に含める
+		precedence--
+	}
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence)
 	return expression
 }
 
+// parseAssignExpression 代入先が変数か添字式でない場合もエラーを記録した上で右辺を読み進める
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{Token: p.currentToken, Target: target}
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	default:
+		p.addError(p.currentToken, nil, fmt.Sprintf("cannot assign to %s", target))
+		expression = nil
+	}
+	p.nextToken()
+	// 右結合にするため、同じ優先順位の演算子を右辺に含める
+	value := p.parseExpression(ASSIGNMENT - 1)
+	if expression == nil {
+		return nil
+	}
+	expression.Value = value
+	return expression
+}
+
 func (p *Parser) parseIfExpression() ast.Expression {
 	expression := &ast.IfExpression{Token: p.currentToken}
 
-	if p.peekToken.Type != token.LPAREN {
+	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
-	p.nextToken()
 
 	p.nextToken()
 	expression.Condition = p.parseExpression(LOWEST)
 
-	if p.peekToken.Type != token.RPAREN {
+	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
-	p.nextToken()
 
-	if p.peekToken.Type != token.LBRACE {
+	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
-	p.nextToken()
 
 	expression.Consequence = p.parseBlockStatement()
 
 	if p.peekToken.Type == token.ELSE {
 		p.nextToken()
 
-		if p.peekToken.Type != token.LBRACE {
+		if !p.expectPeek(token.LBRACE) {
 			return nil
 		}
-		p.nextToken()
 
 		expression.Alternative = p.parseBlockStatement()
 	}
@@ -355,32 +523,43 @@ func (p *Parser) parseIfExpression() ast.Expression {
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.currentToken}
 	block.Statements = make([]ast.Statement, 0)
+	p.blockDepth++
+	defer func() { p.blockDepth-- }()
 	p.nextToken()
 
-	for p.currentToken.Type != token.RBRACE && p.currentToken.Type != token.EOF {
+	for p.currentToken.Type != token.RBRACE {
+		if p.currentToken.Type == token.EOF {
+			p.addError(p.currentToken, []token.Type{token.RBRACE}, "expected RBRACE, got EOF")
+			return nil
+		}
 		stmt := p.parseStatement()
+		if p.panicking {
+			p.synchronize()
+		}
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
 		p.nextToken()
 	}
+	block.Rbrace = p.currentToken
 	return block
 }
 
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	lit := &ast.FunctionLiteral{Token: p.currentToken}
 
-	if p.peekToken.Type != token.LPAREN {
+	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
-	p.nextToken()
 
 	lit.Parameters = p.parseFunctionParameters()
+	if lit.Parameters == nil {
+		return nil
+	}
 
-	if p.peekToken.Type != token.LBRACE {
+	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
-	p.nextToken()
 
 	lit.Body = p.parseBlockStatement()
 	return lit
@@ -394,21 +573,24 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 		return identifiers
 	}
 
-	p.nextToken()
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
 	ident := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
 	identifiers = append(identifiers, ident)
 
 	for p.peekToken.Type == token.COMMA {
 		p.nextToken()
-		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
 		ident := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
 		identifiers = append(identifiers, ident)
 	}
 
-	if p.peekToken.Type != token.RPAREN {
+	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
-	p.nextToken()
 
 	return identifiers
 }
@@ -416,6 +598,7 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.currentToken, Function: function}
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	exp.Rparen = p.currentToken
 	return exp
 }
 
@@ -423,17 +606,22 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	exp := &ast.IndexExpression{Token: p.currentToken, Left: left}
 	p.nextToken()
 	exp.Index = p.parseExpression(LOWEST)
-	if p.peekToken.Type != token.RBRACKET {
+	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
-	p.nextToken()
+	exp.Rbracket = p.currentToken
 	return exp
 }
 
 func (p *Parser) Errors() []string {
-	ret := make([]string, len(p.errors))
+	ret := make([]string, 0, len(p.errors))
 	for _, err := range p.errors {
 		ret = append(ret, err.Error())
 	}
 	return ret
 }
+
+// ParseErrors 位置などの情報を持った構文エラーを返す
+func (p *Parser) ParseErrors() ErrorList {
+	return p.errors
+}
@@ -2,7 +2,9 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/assert"
 
@@ -20,13 +22,13 @@ func TestParser_LetStatement(t *testing.T) {
 
 	tests := []*ast.LetStatement{
 		{
-			Token: token.Token{Type: token.LET, Literal: "let"},
+			Token: token.Token{Type: token.LET, Literal: "let", Pos: token.Position{Offset: 0, Line: 1, Column: 1}, End: token.Position{Offset: 3, Line: 1, Column: 4}},
 			Name: &ast.Identifier{
-				Token: token.Token{Type: token.IDENT, Literal: "x"},
+				Token: token.Token{Type: token.IDENT, Literal: "x", Pos: token.Position{Offset: 4, Line: 1, Column: 5}, End: token.Position{Offset: 5, Line: 1, Column: 6}},
 				Value: "x",
 			},
 			Value: &ast.IntegerLiteral{
-				Token: token.Token{Type: token.INT, Literal: "5"},
+				Token: token.Token{Type: token.INT, Literal: "5", Pos: token.Position{Offset: 8, Line: 1, Column: 9}, End: token.Position{Offset: 9, Line: 1, Column: 10}},
 				Value: 5,
 			},
 		},
@@ -47,9 +49,9 @@ func TestParser_ReturnStatement(t *testing.T) {
 
 	var tests = []*ast.ReturnStatement{
 		{
-			Token: token.Token{Type: token.RETURN, Literal: "return"},
+			Token: token.Token{Type: token.RETURN, Literal: "return", Pos: token.Position{Offset: 0, Line: 1, Column: 1}, End: token.Position{Offset: 6, Line: 1, Column: 7}},
 			ReturnValue: &ast.IntegerLiteral{
-				Token: token.Token{Type: token.INT, Literal: "5"},
+				Token: token.Token{Type: token.INT, Literal: "5", Pos: token.Position{Offset: 7, Line: 1, Column: 8}, End: token.Position{Offset: 8, Line: 1, Column: 9}},
 				Value: 5,
 			},
 		},
@@ -97,6 +99,62 @@ func TestOperator_PrecedenceParsing(t *testing.T) {
 			input:    "1 + (2 + 3) + 4",
 			expected: "((1 + (2 + 3)) + 4)",
 		},
+		{
+			input:    "1 + 2 % 3 * 4",
+			expected: "(1 + ((2 % 3) * 4))",
+		},
+		{
+			input:    "2 ** 3 ** 2",
+			expected: "(2 ** (3 ** 2))",
+		},
+		{
+			input:    "-2 ** 2 * 3",
+			expected: "((-(2 ** 2)) * 3)",
+		},
+		{
+			input:    "2 ** -1",
+			expected: "(2 ** (-1))",
+		},
+		{
+			input:    "1 <= 2 == 3 >= 4",
+			expected: "((1 <= 2) == (3 >= 4))",
+		},
+		{
+			input:    "a || b && c == d",
+			expected: "(a || (b && (c == d)))",
+		},
+		{
+			input:    "a && b || !c",
+			expected: "((a && b) || (!c))",
+		},
+		{
+			input:    "flags & MASK == 0",
+			expected: "((flags & MASK) == 0)",
+		},
+		{
+			input:    "a | b ^ c & d",
+			expected: "(a | (b ^ (c & d)))",
+		},
+		{
+			input:    "1 << 2 + 3 < 4 >> 1",
+			expected: "((1 << (2 + 3)) < (4 >> 1))",
+		},
+		{
+			input:    "~a & -b",
+			expected: "((~a) & (-b))",
+		},
+		{
+			input:    "x = y = 1 + 2",
+			expected: "(x = (y = (1 + 2)))",
+		},
+		{
+			input:    "arr[0] = a || b",
+			expected: "((arr[0]) = (a || b))",
+		},
+		{
+			input:    "let x = h[k] = 1",
+			expected: "let x = ((h[k]) = 1);",
+		},
 		{
 			input:    "add(1 + 2, 3)",
 			expected: "add((1 + 2), 3)",
@@ -115,8 +173,216 @@ func TestOperator_PrecedenceParsing(t *testing.T) {
 	}
 }
 
+func TestParser_FunctionLiteralWithName(t *testing.T) {
+	input := "let hoge = fn() { };"
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParseError(t, p)
+
+	stmt := program.Statements[0].(*ast.LetStatement)
+	assert.Equal(t, "hoge", stmt.Value.(*ast.FunctionLiteral).Name)
+}
+
 func checkParseError(t *testing.T, p *Parser) {
 	for _, err := range p.errors {
 		t.Error(err)
 	}
 }
+
+func TestParser_NodePosition(t *testing.T) {
+	tests := []struct {
+		input string
+		pos   int
+		end   int
+	}{
+		{"foo", 0, 3},
+		{`  "str"`, 2, 7},
+		{"-a * b", 0, 6},
+		{"add(1, 2)", 0, 9},
+		{"arr[1 + 2]", 0, 10},
+		{"[1, 2]", 0, 6},
+		{`{"a": 1}`, 0, 8},
+		{"if (x) { 1 } else { 2 }", 0, 23},
+		{"fn(x) {\n\tx\n}", 0, 12},
+		{"let x = 1 + 2;", 0, 13},
+		{"return x;", 0, 8},
+		{"1.25e3", 0, 6},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParseError(t, p)
+
+		assert.Len(t, program.Statements, 1)
+		stmt := program.Statements[0]
+		assert.Equal(t, tt.pos, stmt.Pos().Offset, tt.input)
+		assert.Equal(t, tt.end, stmt.End().Offset, tt.input)
+		assert.Equal(t, tt.end, program.End().Offset, tt.input)
+	}
+}
+
+func TestParser_Errors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let = 5;", []string{`1:5: expected IDENT, got ASSIGN "="`}},
+		{"let x 5;", []string{`1:7: expected ASSIGN, got INT "5"`}},
+		{"(1 + 2;", []string{`1:7: expected RPAREN, got SEMICOLON ";"`}},
+		{"add(1, 2", []string{"1:9: expected RPAREN, got EOF"}},
+		{"fn(x, 1) { x }", []string{`1:7: expected IDENT, got INT "1"`}},
+		{`{"a" 1}`, []string{`1:6: expected COLON, got INT "1"`}},
+		{"if (x) { 1", []string{"1:11: expected RBRACE, got EOF"}},
+		{"09", []string{`1:1: could not parse "09" as integer`}},
+		{"1e999", []string{`1:1: could not parse "1e999" as float`}},
+		{"let x = ;\nlet y = 1;\nreturn );", []string{
+			`1:9: unexpected SEMICOLON ";"`,
+			`3:8: unexpected RPAREN ")"`,
+		}},
+		{"1 = 2;\nf() = 3;\nx + 1 = 4;", []string{
+			"1:3: cannot assign to 1",
+			"2:5: cannot assign to f()",
+			"3:7: cannot assign to (x + 1)",
+		}},
+		{"fn() { let = fn() { 1 }; 2 }; 3", []string{`1:12: expected IDENT, got ASSIGN "="`}},
+		{"let f = fn() { let = 1; 2 }; f(;\nlet z = 3;", []string{
+			`1:20: expected IDENT, got ASSIGN "="`,
+			`1:32: unexpected SEMICOLON ";"`,
+		}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		assert.Equal(t, tt.expected, p.Errors(), tt.input)
+		assert.Len(t, p.ParseErrors(), len(tt.expected))
+	}
+}
+
+func TestParser_Recovery(t *testing.T) {
+	input := `let a = (1;
+let b = 2;
+let c = fn( { };
+b;`
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+
+	assert.Len(t, p.ParseErrors(), 2)
+	assert.Equal(t, "let b = 2;b", program.String())
+}
+
+func TestParseError_Snippet(t *testing.T) {
+	p := New(lexer.New("let a = 1;\n\tlet b = (a + ;\n"))
+	p.ParseProgram()
+
+	errs := p.ParseErrors()
+	assert.Len(t, errs, 1)
+	assert.Equal(t, &ParseError{
+		Pos:      token.Position{Offset: 25, Line: 2, Column: 15},
+		Expected: nil,
+		Actual: token.Token{
+			Type:    token.SEMICOLON,
+			Literal: ";",
+			Pos:     token.Position{Offset: 25, Line: 2, Column: 15},
+			End:     token.Position{Offset: 26, Line: 2, Column: 16},
+		},
+		Message:    `unexpected SEMICOLON ";"`,
+		Line:       "\tlet b = (a + ;",
+		LineColumn: 1,
+	}, errs[0])
+	assert.Equal(t, "\tlet b = (a + ;\n\t             ^", errs[0].Snippet())
+	assert.EqualError(t, errs, `2:15: unexpected SEMICOLON ";"`)
+}
+
+func TestRuneWidth(t *testing.T) {
+	for _, tt := range []struct {
+		ch       rune
+		expected int
+	}{
+		{'a', 1},
+		{'ä', 1},
+		{'あ', 2},
+		{'ア', 2},
+		{'ｱ', 1},
+		{'漢', 2},
+		{'한', 2},
+		{'Ａ', 2},
+		{'　', 2},
+		{'😀', 2},
+		{'\u0301', 0},
+	} {
+		assert.Equal(t, tt.expected, runeWidth(tt.ch), string(tt.ch))
+	}
+}
+
+func TestParseError_SnippetLongLine(t *testing.T) {
+	input := "let x = " + strings.Repeat("1 + ", 100000) + ";" + strings.Repeat(" 1", 1000)
+	p := New(lexer.NewReader(strings.NewReader(input)))
+	p.ParseProgram()
+
+	errs := p.ParseErrors()
+	assert.Len(t, errs, 1)
+	assert.EqualError(t, errs[0], `1:400009: unexpected SEMICOLON ";"`)
+	assert.Equal(t, 400009-131, errs[0].LineColumn)
+	line := "..." + strings.Repeat("1 + ", 32) + ";" + strings.Repeat(" 1", 63) + " ..."
+	assert.Equal(t, line+"\n"+strings.Repeat(" ", 131)+"^", errs[0].Snippet())
+}
+
+func TestParser_Comments(t *testing.T) {
+	input := `// add two numbers
+let add = fn(a, b) { a + b /* sum */ };
+add(1, 2) // call`
+	p := New(lexer.New(input, lexer.WithComments()))
+	program := p.ParseProgram()
+	checkParseError(t, p)
+
+	assert.Equal(t, "let add = fn<add>(a, b) (a + b);add(1, 2)", program.String())
+	comments := make([]string, 0, len(program.Comments))
+	for _, c := range program.Comments {
+		comments = append(comments, c.Literal)
+	}
+	assert.Equal(t, []string{"// add two numbers", "/* sum */", "// call"}, comments)
+
+	p = New(lexer.New("let a = 1;\nlet b = ;\n/* open"))
+	p.ParseProgram()
+	assert.Equal(t, []string{
+		`2:9: unexpected SEMICOLON ";"`,
+		"3:1: unterminated block comment",
+	}, p.Errors())
+	assert.Equal(t, "/* open\n^", p.ParseErrors()[1].Snippet())
+}
+
+func TestParseError_SnippetUnicode(t *testing.T) {
+	p := New(lexer.New(`let 名前 = "値" +;`))
+	p.ParseProgram()
+
+	errs := p.ParseErrors()
+	assert.Len(t, errs, 1)
+	assert.EqualError(t, errs[0], `1:15: unexpected SEMICOLON ";"`)
+	// 全角文字は2文字分の幅で字下げする
+	assert.Equal(t, "let 名前 = \"値\" +;\n                 ^", errs[0].Snippet())
+}
+
+func TestParser_Reader(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&b, "let x%d = %d;\n", i, i)
+	}
+	b.WriteString("let y = (1;\nlet z = \"abc")
+	input := b.String()
+
+	p := New(lexer.NewReader(iotest.HalfReader(strings.NewReader(input))))
+	program := p.ParseProgram()
+
+	expected := New(lexer.New(input))
+	assert.Equal(t, expected.ParseProgram().String(), program.String())
+	assert.Len(t, program.Statements, 1000)
+	assert.Equal(t, expected.ParseErrors(), p.ParseErrors())
+	assert.Equal(t, []string{
+		`1001:11: expected RPAREN, got SEMICOLON ";"`,
+		"1002:9: unterminated string literal",
+	}, p.Errors())
+	assert.Equal(t, "let y = (1;\n          ^", p.ParseErrors()[0].Snippet())
+}
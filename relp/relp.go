@@ -18,6 +18,9 @@ func Start(in io.Reader, out io.Writer) {
 	constants := make([]object.Object, 0)
 	globals := make([]object.Object, vm.GlobalsSize)
 	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
 
 	fmt.Println("console...")
 	for {
@@ -37,11 +40,11 @@ func Start(in io.Reader, out io.Writer) {
 		}
 		p := parser.New(lexer.New(input))
 		program := p.ParseProgram()
-		if len(p.Errors()) > 0 {
-			for _, msg := range p.Errors() {
-				io.WriteString(out, msg)
+		if errs := p.ParseErrors(); len(errs) > 0 {
+			for _, err := range errs {
+				fmt.Fprintf(out, "%s\n%s\n", err, err.Snippet())
 			}
-			return
+			continue
 		}
 
 		// Compiler
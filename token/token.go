@@ -1,10 +1,24 @@
 package token
 
+import "fmt"
+
 type Type int32
 
 type Token struct {
 	Type    Type
 	Literal string
+	Pos     Position // トークンの先頭の位置
+	End     Position // トークンの直後の位置
+}
+
+type Position struct {
+	Offset int // 入力の先頭からのbyte数(0始まり)
+	Line   int // 1始まり
+	Column int // 1始まり
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 const (
@@ -12,17 +26,31 @@ const (
 	EOF
 	IDENT
 	INT
+	FLOAT
 	STRING
+	COMMENT
 	ASSIGN
 	PLUS
 	MINUS
 	BANG
 	ASTERISK
 	SLASH
+	PERCENT
+	POWER
 	EQ
 	NOT_EQ
 	LT
 	GT
+	LT_EQ
+	GT_EQ
+	AND
+	OR
+	AMPERSAND
+	PIPE
+	CARET
+	TILDE
+	SHIFT_LEFT
+	SHIFT_RIGHT
 	COMMA
 	COLON
 	SEMICOLON
@@ -49,8 +77,12 @@ func (typ Type) String() string {
 		return "IDENT"
 	case INT:
 		return "INT"
+	case FLOAT:
+		return "FLOAT"
 	case STRING:
 		return "STRING"
+	case COMMENT:
+		return "COMMENT"
 	case ASSIGN:
 		return "ASSIGN"
 	case PLUS:
@@ -63,6 +95,10 @@ func (typ Type) String() string {
 		return "ASTERISK"
 	case SLASH:
 		return "SLASH"
+	case PERCENT:
+		return "PERCENT"
+	case POWER:
+		return "POWER"
 	case EQ:
 		return "EQ"
 	case NOT_EQ:
@@ -71,6 +107,26 @@ func (typ Type) String() string {
 		return "LT"
 	case GT:
 		return "GT"
+	case LT_EQ:
+		return "LT_EQ"
+	case GT_EQ:
+		return "GT_EQ"
+	case AND:
+		return "AND"
+	case OR:
+		return "OR"
+	case AMPERSAND:
+		return "AMPERSAND"
+	case PIPE:
+		return "PIPE"
+	case CARET:
+		return "CARET"
+	case TILDE:
+		return "TILDE"
+	case SHIFT_LEFT:
+		return "SHIFT_LEFT"
+	case SHIFT_RIGHT:
+		return "SHIFT_RIGHT"
 	case COMMA:
 		return "COMMA"
 	case COLON:
@@ -118,7 +174,7 @@ var keywords = map[string]Type{
 	"return": RETURN,
 }
 
-func New(typ Type, ch byte) Token {
+func New(typ Type, ch rune) Token {
 	return Token{Type: typ, Literal: string(ch)}
 }
 
@@ -0,0 +1,17 @@
+package vm
+
+import "github.com/karamaru-alpha/monkey/object"
+
+// cell クロージャに捕捉された変数。捕捉した関数と外側の関数が同じcellを参照し、代入を共有する。
+// スタックとClosure.Freeにのみ置かれ、値として積まれることはない
+type cell struct {
+	value object.Object
+}
+
+func (c *cell) Type() object.Type {
+	return c.value.Type()
+}
+
+func (c *cell) Inspect() string {
+	return c.value.Inspect()
+}
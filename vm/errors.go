@@ -0,0 +1,93 @@
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/karamaru-alpha/monkey/token"
+)
+
+// MaxTraceFrames RuntimeErrorに含める呼び出し履歴の数の上限。超えた分は内側と外側を半分ずつ残して省略する
+const MaxTraceFrames = 20
+
+// RuntimeError 実行時のエラーに、発生した時点の呼び出し履歴を付加する
+type RuntimeError struct {
+	Err     error
+	Trace   []TraceFrame // 内側の呼び出しから順に並ぶ
+	Omitted int          // Trace[MaxTraceFrames/2]の前で省略したフレームの数
+}
+
+type TraceFrame struct {
+	Function string // 関数名。無名関数は"<anonymous>"、トップレベルは"<main>"
+	Pos      token.Position
+}
+
+func (e *RuntimeError) Error() string {
+	var out bytes.Buffer
+	out.WriteString(e.Err.Error())
+	for i, f := range e.Trace {
+		if i == MaxTraceFrames/2 && e.Omitted > 0 {
+			fmt.Fprintf(&out, "\n\t... %d more frames", e.Omitted)
+		}
+		fmt.Fprintf(&out, "\n\tat %s (%s)", f.Function, f.Pos)
+	}
+	return out.String()
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+// ErrOutOfGas gasの上限を超えて実行が中断されたことを表す。errors.Isで判定する
+var ErrOutOfGas = errors.New("out of gas")
+
+type OutOfGasError struct {
+	Limit uint64
+	Used  uint64 // 中断するまでに消費したgas
+}
+
+func (e *OutOfGasError) Error() string {
+	return fmt.Sprintf("%s: used %d of %d", ErrOutOfGas, e.Used, e.Limit)
+}
+
+func (e *OutOfGasError) Is(target error) bool {
+	return target == ErrOutOfGas
+}
+
+// ErrResourceExhausted Limitsで設定した制限を超えて実行が中断されたことを表す。errors.Isで判定する
+var ErrResourceExhausted = errors.New("resource exhausted")
+
+type ResourceExhaustedError struct {
+	Resource  string // "string length", "collection size", "allocated bytes"
+	Limit     int64
+	Requested int64
+}
+
+func (e *ResourceExhaustedError) Error() string {
+	return fmt.Sprintf("%s: %s %d exceeds limit %d", ErrResourceExhausted, e.Resource, e.Requested, e.Limit)
+}
+
+func (e *ResourceExhaustedError) Is(target error) bool {
+	return target == ErrResourceExhausted
+}
+
+// ErrStackOverflow スタックか呼び出しの深さが上限を超えたことを表す。errors.Isで判定する
+var ErrStackOverflow = errors.New("stack overflow")
+
+type StackOverflowError struct {
+	Depth        int // 上限を超えた時点での呼び出しの深さ
+	MaxDepth     int
+	MaxStackSize int // スタックの大きさが上限を超えた場合のみ設定される
+}
+
+func (e *StackOverflowError) Error() string {
+	if e.MaxStackSize > 0 {
+		return fmt.Sprintf("%s: maximum stack size %d exceeded at call depth %d", ErrStackOverflow, e.MaxStackSize, e.Depth)
+	}
+	return fmt.Sprintf("%s: maximum call depth %d exceeded", ErrStackOverflow, e.MaxDepth)
+}
+
+func (e *StackOverflowError) Is(target error) bool {
+	return target == ErrStackOverflow
+}
@@ -6,14 +6,15 @@ import (
 )
 
 type Frame struct {
-	fn *object.CompiledFunction
-	ip int
+	cl          *object.Closure
+	ip          int
+	basePointer int // 関数呼び出し前のsp。ローカル変数はここから積まれる
 }
 
-func NewFrame(fn *object.CompiledFunction) *Frame {
-	return &Frame{fn: fn, ip: -1}
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
 }
 
 func (f *Frame) Instructions() code.Instructions {
-	return f.fn.Instructions
+	return f.cl.Fn.Instructions
 }
@@ -0,0 +1,146 @@
+package vm
+
+import (
+	"math/bits"
+
+	"github.com/karamaru-alpha/monkey/object"
+)
+
+// おおよそのメモリ使用量を見積もるための各オブジェクトのサイズ(byte)
+const (
+	objectSize    = 16 // interfaceの値1つ分
+	stringSize    = 16
+	arraySize     = 24
+	hashSize      = 48
+	hashPairSize  = 64 // HashKeyとHashPairとmapのbucketの分
+	integerSize   = 8
+	allocOverhead = 16
+)
+
+// Limits 0の項目は制限しない
+type Limits struct {
+	MaxStringLength   int   // 文字列の最大長(byte)
+	MaxCollectionSize int   // 配列の要素数・ハッシュのペア数の最大
+	MaxAllocatedBytes int64 // 実行中に確保するメモリの見積もりの合計の最大
+}
+
+// WithLimits 文字列・配列・ハッシュの生成とbuiltin関数の戻り値に制限をかける
+func WithLimits(limits Limits) Option {
+	return func(v *VM) {
+		v.limits = limits
+	}
+}
+
+// AllocatedBytes これまでの実行で確保したメモリの見積もり
+func (v *VM) AllocatedBytes() int64 {
+	return v.allocated
+}
+
+func (v *VM) allocString(length int) error {
+	if v.limits.MaxStringLength > 0 && length > v.limits.MaxStringLength {
+		return &ResourceExhaustedError{Resource: "string length", Limit: int64(v.limits.MaxStringLength), Requested: int64(length)}
+	}
+	return v.alloc(int64(allocOverhead + stringSize + length))
+}
+
+func (v *VM) allocArray(length int) error {
+	if err := v.checkCollectionSize(length); err != nil {
+		return err
+	}
+	return v.alloc(int64(allocOverhead + arraySize + objectSize*length))
+}
+
+func (v *VM) allocHash(numPairs int) error {
+	if err := v.checkCollectionSize(numPairs); err != nil {
+		return err
+	}
+	return v.alloc(int64(allocOverhead + hashSize + hashPairSize*numPairs))
+}
+
+// allocHashPair 既存のハッシュにペアを追加し、numPairs個になる
+func (v *VM) allocHashPair(numPairs int) error {
+	if err := v.checkCollectionSize(numPairs); err != nil {
+		return err
+	}
+	return v.alloc(hashPairSize)
+}
+
+func (v *VM) checkCollectionSize(size int) error {
+	if v.limits.MaxCollectionSize > 0 && size > v.limits.MaxCollectionSize {
+		return &ResourceExhaustedError{Resource: "collection size", Limit: int64(v.limits.MaxCollectionSize), Requested: int64(size)}
+	}
+	return nil
+}
+
+func (v *VM) alloc(size int64) error {
+	if err := v.checkAlloc(size); err != nil {
+		return err
+	}
+	v.allocated += size
+	return nil
+}
+
+func (v *VM) checkAlloc(size int64) error {
+	if v.limits.MaxAllocatedBytes > 0 && v.allocated+size > v.limits.MaxAllocatedBytes {
+		return &ResourceExhaustedError{Resource: "allocated bytes", Limit: v.limits.MaxAllocatedBytes, Requested: v.allocated + size}
+	}
+	return nil
+}
+
+// checkIntegerBits 多倍長整数を計算する前に、結果のビット長の見積もりを制限と照らし合わせる。
+// 確保した量には計算した後にallocObjectで数える
+func (v *VM) checkIntegerBits(n uint64) error {
+	// object.MaxIntegerBitsを超える場合は演算自体がエラーになる
+	if n > object.MaxIntegerBits {
+		return nil
+	}
+	return v.checkAlloc(int64(allocOverhead + integerSize + n/8))
+}
+
+// allocObject builtin関数が返したオブジェクトを制限と照らし合わせる。
+// 引数をそのまま返した場合も新たに確保したものとして数えるため、見積もりは多めになる
+func (v *VM) allocObject(obj object.Object) error {
+	return v.allocObjectOnce(obj, make(map[object.Object]bool))
+}
+
+// allocObjectOnce 同じ配列やハッシュを複数回参照している場合や、参照が循環している場合も1度だけ数える
+func (v *VM) allocObjectOnce(obj object.Object, seen map[object.Object]bool) error {
+	switch obj := obj.(type) {
+	case *object.String:
+		return v.allocString(len(obj.Value))
+	case *object.Integer:
+		return v.alloc(allocOverhead + integerSize)
+	case *object.BigInt:
+		return v.alloc(int64(allocOverhead + integerSize + len(obj.Value.Bits())*bits.UintSize/8))
+	case *object.Array:
+		if seen[obj] {
+			return nil
+		}
+		seen[obj] = true
+		if err := v.allocArray(len(obj.Elements)); err != nil {
+			return err
+		}
+		for _, e := range obj.Elements {
+			if err := v.allocObjectOnce(e, seen); err != nil {
+				return err
+			}
+		}
+	case *object.Hash:
+		if seen[obj] {
+			return nil
+		}
+		seen[obj] = true
+		if err := v.allocHash(len(obj.Pairs)); err != nil {
+			return err
+		}
+		for _, pair := range obj.Pairs {
+			if err := v.allocObjectOnce(pair.Key, seen); err != nil {
+				return err
+			}
+			if err := v.allocObjectOnce(pair.Value, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
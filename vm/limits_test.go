@@ -0,0 +1,75 @@
+package vm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/karamaru-alpha/monkey/compiler"
+	"github.com/karamaru-alpha/monkey/lexer"
+	"github.com/karamaru-alpha/monkey/object"
+	"github.com/karamaru-alpha/monkey/parser"
+)
+
+func TestVM_Limits(t *testing.T) {
+	repeat := &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		elements := make([]object.Object, args[0].(*object.Integer).Value)
+		for i := range elements {
+			elements[i] = Null
+		}
+		return &object.Array{Elements: elements}
+	}}
+	cyclic := &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		array := &object.Array{Elements: []object.Object{Null, Null}}
+		array.Elements[0] = array
+		array.Elements[1] = &object.Array{Elements: []object.Object{array}}
+		return array
+	}}
+
+	for _, tt := range []struct {
+		input    string
+		limits   Limits
+		expected *ResourceExhaustedError
+	}{
+		{`"abc" + "de"`, Limits{MaxStringLength: 5}, nil},
+		{`"abc" + "def"`, Limits{MaxStringLength: 5}, &ResourceExhaustedError{Resource: "string length", Limit: 5, Requested: 6}},
+		{`[1, 2, 3]`, Limits{MaxCollectionSize: 3}, nil},
+		{`[1, 2, 3, 4]`, Limits{MaxCollectionSize: 3}, &ResourceExhaustedError{Resource: "collection size", Limit: 3, Requested: 4}},
+		{`{1: 1, 2: 2}`, Limits{MaxCollectionSize: 1}, &ResourceExhaustedError{Resource: "collection size", Limit: 1, Requested: 2}},
+		{`repeat(10)`, Limits{MaxCollectionSize: 5}, &ResourceExhaustedError{Resource: "collection size", Limit: 5, Requested: 10}},
+		// 配列1つ: 16 + 24 + 16*2 = 72
+		{`[1, 2]`, Limits{MaxAllocatedBytes: 72}, nil},
+		{`[1, 2]; [1, 2]`, Limits{MaxAllocatedBytes: 100}, &ResourceExhaustedError{Resource: "allocated bytes", Limit: 100, Requested: 144}},
+		// 2 ** 100000の見積もり: 16 + 8 + 2*100000/8 = 25024。計算する前に止める
+		{`2 ** 100000`, Limits{MaxAllocatedBytes: 25000}, &ResourceExhaustedError{Resource: "allocated bytes", Limit: 25000, Requested: 25024}},
+		{`2 ** 100000`, Limits{MaxAllocatedBytes: 30000}, nil},
+		// 自身を含む配列をbuiltin関数が返しても、各配列を数えるのは1度だけ: (16 + 24 + 16*2) + (16 + 24 + 16) = 128
+		{`cyclic()`, Limits{MaxAllocatedBytes: 128}, nil},
+		{`cyclic()`, Limits{MaxAllocatedBytes: 127}, &ResourceExhaustedError{Resource: "allocated bytes", Limit: 127, Requested: 128}},
+		// 1 << 100000の見積もり: 16 + 8 + 100001/8 = 12524
+		{`1 << 100000`, Limits{MaxAllocatedBytes: 12000}, &ResourceExhaustedError{Resource: "allocated bytes", Limit: 12000, Requested: 12524}},
+		{`1 << 100000`, Limits{MaxAllocatedBytes: 13000}, nil},
+		{`let h = {1: 1}; h[1] = 2; h[2] = 2`, Limits{MaxCollectionSize: 1}, &ResourceExhaustedError{Resource: "collection size", Limit: 1, Requested: 2}},
+		// ハッシュ1つ: 16 + 48 + 64 = 128。ペアの追加で64
+		{`let h = {1: 1}; h[2] = 2`, Limits{MaxAllocatedBytes: 192}, nil},
+		{`let h = {1: 1}; h[2] = 2; h[3] = 3`, Limits{MaxAllocatedBytes: 192}, &ResourceExhaustedError{Resource: "allocated bytes", Limit: 192, Requested: 256}},
+	} {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+
+		symbolTable := compiler.NewSymbolTable()
+		symbolTable.DefineBuiltin(0, "repeat")
+		symbolTable.DefineBuiltin(1, "cyclic")
+		c := compiler.NewWithState(symbolTable, []object.Object{})
+		assert.NoError(t, c.Compile(program))
+
+		vm := New(c.Bytecode(), WithLimits(tt.limits), WithBuiltins([]*object.Builtin{repeat, cyclic}))
+		err := vm.Run()
+		if tt.expected == nil {
+			assert.NoError(t, err)
+			continue
+		}
+		assert.ErrorIs(t, err, ErrResourceExhausted)
+		assert.Equal(t, tt.expected, errors.Unwrap(err))
+	}
+}
@@ -1,8 +1,8 @@
 package vm
 
 import (
+	"context"
 	"encoding/binary"
-	"errors"
 	"fmt"
 
 	"github.com/karamaru-alpha/monkey/code"
@@ -11,15 +11,22 @@ import (
 )
 
 const (
-	StackSize   = 2048
+	StackSize   = 2048 // スタックの大きさの上限の既定値
 	GlobalsSize = 65536
-	MaxFrames   = 1024
+	MaxFrames   = 1024 // 呼び出しの深さの上限の既定値
+
+	// 最初に確保する大きさ。足りなくなったら上限まで倍々に広げる
+	initialStackSize = 256
+	initialFrames    = 64
+
+	// cancelCheckInterval 何命令ごとにcontextのキャンセルを確認するか(2の累乗)
+	cancelCheckInterval = 1024
 )
 
 var (
-	True  = &object.Boolean{Value: true}
-	False = &object.Boolean{Value: false}
-	Null  = &object.Null{}
+	True  = object.TrueObject
+	False = object.FalseObject
+	Null  = object.NullObject
 )
 
 type VM struct {
@@ -27,33 +34,116 @@ type VM struct {
 	stack     []object.Object
 	sp        int // Always points to the next value. top of stack is stack[sp-1]
 	globals   []object.Object
+	builtins  []*object.Builtin
 
 	frames     []*Frame
 	frameIndex int
+
+	maxStackSize int
+	maxFrames    int
+
+	ctx   context.Context
+	steps uint64 // 実行した命令数
+
+	costs    code.CostTable
+	gasLimit uint64 // 0の場合は上限なし
+	gasUsed  uint64
+
+	limits    Limits
+	allocated int64 // 確保したメモリの見積もり(byte)
 }
 
-func New(bytecode *compiler.Bytecode) *VM {
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
-	mainFrame := NewFrame(mainFn)
+type Option func(*VM)
 
-	frames := make([]*Frame, MaxFrames)
-	frames[0] = mainFrame
-	return &VM{
-		constants:  bytecode.Constants,
-		stack:      make([]object.Object, StackSize),
-		sp:         0,
-		globals:    make([]object.Object, GlobalsSize),
-		frames:     frames,
-		frameIndex: 1,
+// WithGlobalsStore 複数のバイトコードの実行でグローバル変数を共有する
+func WithGlobalsStore(s []object.Object) Option {
+	return func(v *VM) {
+		v.globals = s
 	}
 }
 
-func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
-	vm := New(bytecode)
-	vm.globals = s
+// WithBuiltins OpGetBuiltinで参照するbuiltin関数を差し替える。並び順はコンパイル時のSymbolTableと揃える
+func WithBuiltins(builtins []*object.Builtin) Option {
+	return func(v *VM) {
+		v.builtins = builtins
+	}
+}
+
+// WithMaxStackSize スタックに積める値の数の上限を設定する。1未満の値は無視する
+func WithMaxStackSize(size int) Option {
+	return func(v *VM) {
+		if size < 1 {
+			return
+		}
+		v.maxStackSize = size
+	}
+}
+
+// WithMaxFrames 関数呼び出しの深さの上限を設定する。メインのフレームも1つと数え、1未満の値は無視する
+func WithMaxFrames(depth int) Option {
+	return func(v *VM) {
+		if depth < 1 {
+			return
+		}
+		v.maxFrames = depth
+	}
+}
+
+// WithGasLimit 実行できるgasの上限を設定する。消費量はWithCostTableの表に従う
+func WithGasLimit(limit uint64) Option {
+	return func(v *VM) {
+		v.gasLimit = limit
+	}
+}
+
+// WithGasUsed 消費済みのgasを設定する。複数のvmで1つのgasの上限を共有する場合に使う
+func WithGasUsed(used uint64) Option {
+	return func(v *VM) {
+		v.gasUsed = used
+	}
+}
+
+func WithCostTable(costs code.CostTable) Option {
+	return func(v *VM) {
+		v.costs = costs
+	}
+}
+
+func New(bytecode *compiler.Bytecode, opts ...Option) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, SourceMap: bytecode.SourceMap}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	builtins := make([]*object.Builtin, 0, len(object.Builtins))
+	for _, def := range object.Builtins {
+		builtins = append(builtins, def.Builtin)
+	}
+
+	vm := &VM{
+		ctx:          context.Background(),
+		costs:        code.DefaultCosts,
+		constants:    bytecode.Constants,
+		sp:           0,
+		globals:      make([]object.Object, GlobalsSize),
+		builtins:     builtins,
+		frameIndex:   1,
+		maxStackSize: StackSize,
+		maxFrames:    MaxFrames,
+	}
+	for _, opt := range opts {
+		opt(vm)
+	}
+
+	vm.stack = make([]object.Object, minInt(initialStackSize, vm.maxStackSize))
+	vm.frames = make([]*Frame, minInt(initialFrames, vm.maxFrames))
+	vm.frames[0] = mainFrame
 	return vm
 }
 
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	return New(bytecode, WithGlobalsStore(s))
+}
+
 func (v *VM) StackTop() object.Object {
 	if v.sp == 0 {
 		return nil
@@ -65,17 +155,113 @@ func (v *VM) LastPoppedStackElem() object.Object {
 	return v.stack[v.sp]
 }
 
+// GasUsed これまでの実行で消費したgas
+func (v *VM) GasUsed() uint64 {
+	return v.gasUsed
+}
+
 func (v *VM) Run() error {
+	return v.RunContext(context.Background())
+}
+
+// RunContext ctxがキャンセルされると実行を中断し、object.ErrCanceledを満たすエラーを返す
+func (v *VM) RunContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return &object.CanceledError{Err: err}
+	}
+	v.ctx = ctx
+	if err := v.run(0); err != nil {
+		return v.newRuntimeError(err, 0)
+	}
+	return nil
+}
+
+// LookupGlobal コンパイル時のSymbolTableを使ってグローバル変数の値を取得する
+func (v *VM) LookupGlobal(symbolTable *compiler.SymbolTable, name string) (object.Object, error) {
+	symbol, ok := symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope {
+		return nil, fmt.Errorf("undefined global variable %s", name)
+	}
+	obj := v.globals[symbol.Index]
+	if obj == nil {
+		return nil, fmt.Errorf("global variable %s is not initialized", name)
+	}
+	return obj, nil
+}
+
+// Call Goから関数を呼び出す。Runの後に呼び出せば、スクリプトで定義した関数をコールバックとして使える
+func (v *VM) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	return v.CallContext(context.Background(), fn, args...)
+}
+
+func (v *VM) CallContext(ctx context.Context, fn object.Object, args ...object.Object) (object.Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, &object.CanceledError{Err: err}
+	}
+	// builtin関数から呼び出された場合も、呼び出し元は元のctxで実行を続ける
+	prev := v.ctx
+	v.ctx = ctx
+	defer func() { v.ctx = prev }()
+	if compiledFn, ok := fn.(*object.CompiledFunction); ok {
+		fn = &object.Closure{Fn: compiledFn}
+	}
+
+	sp := v.sp
+	depth := v.frameIndex
+	if err := v.callGo(fn, args, depth); err != nil {
+		err = v.newRuntimeError(err, depth)
+		// 実行途中のフレームとスタックを呼び出し前の状態に戻す
+		v.frameIndex = depth
+		v.sp = sp
+		return nil, err
+	}
+	return v.pop(), nil
+}
+
+func (v *VM) callGo(fn object.Object, args []object.Object, depth int) error {
+	if err := v.push(fn); err != nil {
+		return err
+	}
+	for _, arg := range args {
+		if err := v.push(arg); err != nil {
+			return err
+		}
+	}
+	if err := v.callFunction(len(args)); err != nil {
+		return err
+	}
+	return v.run(depth)
+}
+
+// run フレームの深さがdepthに戻るか、命令を読み切るまで実行する
+func (v *VM) run(depth int) error {
 	var ip int
 	var ins code.Instructions
 	var op code.Opcode
 
-	for v.currentFrame().ip < len(v.currentFrame().Instructions())-1 {
+	done := v.ctx.Done()
+	for v.frameIndex > depth && v.currentFrame().ip < len(v.currentFrame().Instructions())-1 {
+		v.steps++
+		if done != nil && v.steps%cancelCheckInterval == 0 {
+			select {
+			case <-done:
+				return &object.CanceledError{Err: v.ctx.Err()}
+			default:
+			}
+		}
+
 		v.currentFrame().ip++
 
 		ip = v.currentFrame().ip
 		ins = v.currentFrame().Instructions()
 		op = code.Opcode(ins[ip])
+
+		cost := v.costs.Cost(op)
+		if v.gasLimit > 0 && v.gasUsed+cost > v.gasLimit {
+			return &OutOfGasError{Limit: v.gasLimit, Used: v.gasUsed}
+		}
+		v.gasUsed += cost
+
 		switch op {
 		case code.OpConstant:
 			constIndex := int(binary.BigEndian.Uint16(ins[ip+1:]))
@@ -84,7 +270,8 @@ func (v *VM) Run() error {
 			if err := v.push(v.constants[constIndex]); err != nil {
 				return err
 			}
-		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod, code.OpPow,
+			code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight:
 			if err := v.executeBinaryOperation(op); err != nil {
 				return err
 			}
@@ -100,7 +287,7 @@ func (v *VM) Run() error {
 			if err := v.push(Null); err != nil {
 				return err
 			}
-		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan:
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterThanOrEqual, code.OpLessThan, code.OpLessThanOrEqual:
 			if err := v.executeComparison(op); err != nil {
 				return err
 			}
@@ -112,6 +299,10 @@ func (v *VM) Run() error {
 			if err := v.executeMinusOperator(); err != nil {
 				return err
 			}
+		case code.OpBitNot:
+			if err := v.executeBitNotOperator(); err != nil {
+				return err
+			}
 		case code.OpJump:
 			position := int(binary.BigEndian.Uint16(ins[ip+1:]))
 			v.currentFrame().ip = position - 1
@@ -130,14 +321,62 @@ func (v *VM) Run() error {
 		case code.OpGetGlobal:
 			globalIndex := int(binary.BigEndian.Uint16(ins[ip+1:]))
 			v.currentFrame().ip += 2
+			// 実行に失敗したRunで定義された変数は、シンボルテーブルには残るが値は設定されない
+			if v.globals[globalIndex] == nil {
+				return fmt.Errorf("global variable is not initialized")
+			}
 			if err := v.push(v.globals[globalIndex]); err != nil {
 				return err
 			}
+		case code.OpSetLocal:
+			localIndex := int(ins[ip+1])
+			v.currentFrame().ip += 1
+
+			frame := v.currentFrame()
+			if c, ok := v.stack[frame.basePointer+localIndex].(*cell); ok {
+				c.value = v.pop()
+			} else {
+				v.stack[frame.basePointer+localIndex] = v.pop()
+			}
+		case code.OpGetLocal:
+			localIndex := int(ins[ip+1])
+			v.currentFrame().ip += 1
+
+			frame := v.currentFrame()
+			local := v.stack[frame.basePointer+localIndex]
+			if c, ok := local.(*cell); ok {
+				local = c.value
+			}
+			// 実行されなかったletのローカル変数は値が設定されていない
+			if local == nil {
+				return fmt.Errorf("local variable is not initialized")
+			}
+			if err := v.push(local); err != nil {
+				return err
+			}
+		case code.OpCaptureLocal:
+			localIndex := int(ins[ip+1])
+			v.currentFrame().ip += 1
+
+			// 初めて捕捉されたときにcellに入れ、以降はローカル変数もcellを通して読み書きする
+			frame := v.currentFrame()
+			c, ok := v.stack[frame.basePointer+localIndex].(*cell)
+			if !ok {
+				c = &cell{value: v.stack[frame.basePointer+localIndex]}
+				v.stack[frame.basePointer+localIndex] = c
+			}
+			if err := v.push(c); err != nil {
+				return err
+			}
 		case code.OpArray:
 			numElements := int(binary.BigEndian.Uint16(ins[ip+1:]))
 			v.currentFrame().ip += 2
 
-			array := v.buildArray(v.sp-numElements, v.sp)
+			array, err := v.buildArray(v.sp-numElements, v.sp)
+			if err != nil {
+				return err
+			}
+			v.sp = v.sp - numElements
 			if err := v.push(array); err != nil {
 				return err
 			}
@@ -149,6 +388,7 @@ func (v *VM) Run() error {
 			if err != nil {
 				return err
 			}
+			v.sp = v.sp - numElements
 			if err := v.push(hash); err != nil {
 				return err
 			}
@@ -158,17 +398,65 @@ func (v *VM) Run() error {
 			if err := v.executeIndexExpression(left, index); err != nil {
 				return err
 			}
+		case code.OpSetIndex:
+			value := v.pop()
+			index := v.pop()
+			left := v.pop()
+			if err := v.executeSetIndex(left, index, value); err != nil {
+				return err
+			}
+		case code.OpClosure:
+			constIndex := int(binary.BigEndian.Uint16(ins[ip+1:]))
+			numFree := int(ins[ip+3])
+			v.currentFrame().ip += 3
+
+			if err := v.pushClosure(constIndex, numFree); err != nil {
+				return err
+			}
+		case code.OpGetFree:
+			freeIndex := int(ins[ip+1])
+			v.currentFrame().ip += 1
+
+			currentClosure := v.currentFrame().cl
+			free := currentClosure.Free[freeIndex].(*cell).value
+			if free == nil {
+				return fmt.Errorf("free variable is not initialized")
+			}
+			if err := v.push(free); err != nil {
+				return err
+			}
+		case code.OpSetFree:
+			freeIndex := int(ins[ip+1])
+			v.currentFrame().ip += 1
+
+			currentClosure := v.currentFrame().cl
+			currentClosure.Free[freeIndex].(*cell).value = v.pop()
+		case code.OpCaptureFree:
+			freeIndex := int(ins[ip+1])
+			v.currentFrame().ip += 1
+
+			currentClosure := v.currentFrame().cl
+			if err := v.push(currentClosure.Free[freeIndex]); err != nil {
+				return err
+			}
+		case code.OpGetBuiltin:
+			builtinIndex := int(ins[ip+1])
+			v.currentFrame().ip += 1
+
+			if err := v.push(v.builtins[builtinIndex]); err != nil {
+				return err
+			}
 		case code.OpCall:
-			fn, ok := v.stack[v.sp-1].(*object.CompiledFunction)
-			if !ok {
-				return fmt.Errorf("calling non-function")
+			numArgs := int(ins[ip+1])
+			v.currentFrame().ip += 1
+
+			if err := v.callFunction(numArgs); err != nil {
+				return err
 			}
-			frame := NewFrame(fn)
-			v.pushFrame(frame)
 		case code.OpReturn:
 			returnValue := v.pop()
-			v.popFrame()
-			v.pop()
+			frame := v.popFrame()
+			v.sp = frame.basePointer - 1 // 呼び出された関数自体も取り除く
 			if err := v.push(returnValue); err != nil {
 				return err
 			}
@@ -179,6 +467,67 @@ func (v *VM) Run() error {
 	return nil
 }
 
+func (v *VM) callFunction(numArgs int) error {
+	switch callee := v.stack[v.sp-1-numArgs].(type) {
+	case *object.Closure:
+		return v.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return v.callBuiltin(callee, numArgs)
+	}
+	return fmt.Errorf("calling non-function")
+}
+
+func (v *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
+	}
+
+	// 引数はそのままローカル変数の先頭として扱う
+	frame := NewFrame(cl, v.sp-numArgs)
+	if err := v.ensureStack(frame.basePointer + cl.Fn.NumLocals); err != nil {
+		return err
+	}
+	if err := v.pushFrame(frame); err != nil {
+		return err
+	}
+	// 以前の呼び出しで捕捉されたcellが残っていると、OpSetLocalがそれを書き換えてしまう
+	for i := frame.basePointer + numArgs; i < frame.basePointer+cl.Fn.NumLocals; i++ {
+		v.stack[i] = nil
+	}
+	v.sp = frame.basePointer + cl.Fn.NumLocals
+	return nil
+}
+
+func (v *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := v.stack[v.sp-numArgs : v.sp]
+
+	result := builtin.Fn(args...)
+	v.sp = v.sp - numArgs - 1
+
+	if result == nil {
+		return v.push(Null)
+	}
+	if err := v.allocObject(result); err != nil {
+		return err
+	}
+	return v.push(result)
+}
+
+func (v *VM) pushClosure(constIndex, numFree int) error {
+	constant := v.constants[constIndex]
+	fn, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	// 捕捉する変数はOpCaptureLocalとOpCaptureFreeでcellとして積まれている
+	free := make([]object.Object, numFree)
+	copy(free, v.stack[v.sp-numFree:v.sp])
+	v.sp = v.sp - numFree
+
+	return v.push(&object.Closure{Fn: fn, Free: free})
+}
+
 func (v *VM) executeBinaryOperation(op code.Opcode) error {
 	right := v.pop()
 	left := v.pop()
@@ -186,6 +535,9 @@ func (v *VM) executeBinaryOperation(op code.Opcode) error {
 	if left.Type() == object.INTEGER && right.Type() == object.INTEGER {
 		return v.executeBinaryIntegerOperation(op, left, right)
 	}
+	if object.IsFloatOperation(left, right) {
+		return v.executeBinaryFloatOperation(op, left, right)
+	}
 	if left.Type() == object.STRING && right.Type() == object.STRING {
 		return v.executeBinaryStringOperation(op, left, right)
 	}
@@ -194,22 +546,84 @@ func (v *VM) executeBinaryOperation(op code.Opcode) error {
 }
 
 func (v *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.Object) error {
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
-	var result int64
+	var result object.Object
+	var err error
+	switch op {
+	case code.OpAdd:
+		result = object.AddIntegers(left, right)
+	case code.OpSub:
+		result = object.SubIntegers(left, right)
+	case code.OpDiv:
+		result, err = object.DivIntegers(left, right)
+	case code.OpMul:
+		// int64に収まる積は多倍長整数を確保しないため数えない
+		if n := object.MulBitLen(left, right); n > 63 {
+			if err := v.checkIntegerBits(n); err != nil {
+				return err
+			}
+		}
+		result, err = object.MulIntegers(left, right)
+	case code.OpMod:
+		result, err = object.ModIntegers(left, right)
+	case code.OpPow:
+		if err := v.checkIntegerBits(object.PowBitLen(left, right)); err != nil {
+			return err
+		}
+		result, err = object.PowIntegers(left, right)
+	case code.OpBitAnd:
+		result = object.AndIntegers(left, right)
+	case code.OpBitOr:
+		result = object.OrIntegers(left, right)
+	case code.OpBitXor:
+		result = object.XorIntegers(left, right)
+	case code.OpShiftLeft:
+		if err := v.checkIntegerBits(object.ShiftLeftBitLen(left, right)); err != nil {
+			return err
+		}
+		result, err = object.ShiftLeftIntegers(left, right)
+	case code.OpShiftRight:
+		result, err = object.ShiftRightIntegers(left, right)
+	default:
+		return fmt.Errorf("unknown integer operator: %d", op)
+	}
+	if err != nil {
+		return err
+	}
+	// 多倍長整数は際限なく大きくなりうるため、確保した量として数える
+	if _, ok := result.(*object.BigInt); ok {
+		if err := v.allocObject(result); err != nil {
+			return err
+		}
+	}
+	return v.push(result)
+}
+
+func (v *VM) executeBinaryFloatOperation(op code.Opcode, left, right object.Object) error {
+	leftValue, _ := object.ToFloat64(left)
+	rightValue, _ := object.ToFloat64(right)
+	var result float64
+	var err error
 	switch op {
 	case code.OpAdd:
 		result = leftValue + rightValue
 	case code.OpSub:
 		result = leftValue - rightValue
 	case code.OpDiv:
-		result = leftValue / rightValue
+		result, err = object.DivFloats(leftValue, rightValue)
 	case code.OpMul:
 		result = leftValue * rightValue
+	case code.OpMod:
+		result, err = object.ModFloats(leftValue, rightValue)
+	case code.OpPow:
+		result, err = object.PowFloats(leftValue, rightValue)
 	default:
-		return fmt.Errorf("unknown integer operator: %d", op)
+		// ビット演算は整数にのみ定義されている
+		return fmt.Errorf("unsupported types for binary operation: %s %s", left.Type(), right.Type())
 	}
-	return v.push(&object.Integer{Value: result})
+	if err != nil {
+		return err
+	}
+	return v.push(&object.Float{Value: result})
 }
 
 func (v *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) error {
@@ -220,6 +634,10 @@ func (v *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Obj
 	leftValue := left.(*object.String).Value
 	rightValue := right.(*object.String).Value
 
+	// 連結する前に確認し、巨大な文字列を確保しないようにする
+	if err := v.allocString(len(leftValue) + len(rightValue)); err != nil {
+		return err
+	}
 	return v.push(&object.String{Value: leftValue + rightValue})
 }
 
@@ -230,6 +648,12 @@ func (v *VM) executeComparison(op code.Opcode) error {
 	if left.Type() == object.INTEGER && right.Type() == object.INTEGER {
 		return v.executeIntegerComparison(op, left, right)
 	}
+	if object.IsFloatOperation(left, right) {
+		return v.executeFloatComparison(op, left, right)
+	}
+	if left.Type() == object.STRING && right.Type() == object.STRING {
+		return v.executeStringComparison(op, left, right)
+	}
 
 	switch op {
 	case code.OpEqual:
@@ -242,8 +666,28 @@ func (v *VM) executeComparison(op code.Opcode) error {
 }
 
 func (v *VM) executeIntegerComparison(op code.Opcode, left, right object.Object) error {
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
+	cmp := object.CompareIntegers(left, right)
+	switch op {
+	case code.OpEqual:
+		return v.push(v.nativeBoolToBooleanObject(cmp == 0))
+	case code.OpNotEqual:
+		return v.push(v.nativeBoolToBooleanObject(cmp != 0))
+	case code.OpGreaterThan:
+		return v.push(v.nativeBoolToBooleanObject(cmp > 0))
+	case code.OpGreaterThanOrEqual:
+		return v.push(v.nativeBoolToBooleanObject(cmp >= 0))
+	case code.OpLessThan:
+		return v.push(v.nativeBoolToBooleanObject(cmp < 0))
+	case code.OpLessThanOrEqual:
+		return v.push(v.nativeBoolToBooleanObject(cmp <= 0))
+	default:
+		return fmt.Errorf("unknown operator: %d", op)
+	}
+}
+
+func (v *VM) executeFloatComparison(op code.Opcode, left, right object.Object) error {
+	leftValue, _ := object.ToFloat64(left)
+	rightValue, _ := object.ToFloat64(right)
 	switch op {
 	case code.OpEqual:
 		return v.push(v.nativeBoolToBooleanObject(leftValue == rightValue))
@@ -251,6 +695,34 @@ func (v *VM) executeIntegerComparison(op code.Opcode, left, right object.Object)
 		return v.push(v.nativeBoolToBooleanObject(leftValue != rightValue))
 	case code.OpGreaterThan:
 		return v.push(v.nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterThanOrEqual:
+		return v.push(v.nativeBoolToBooleanObject(leftValue >= rightValue))
+	case code.OpLessThan:
+		return v.push(v.nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpLessThanOrEqual:
+		return v.push(v.nativeBoolToBooleanObject(leftValue <= rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %d", op)
+	}
+}
+
+// executeStringComparison 文字列はbyte列として辞書順で比較する
+func (v *VM) executeStringComparison(op code.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+	switch op {
+	case code.OpEqual:
+		return v.push(v.nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return v.push(v.nativeBoolToBooleanObject(leftValue != rightValue))
+	case code.OpGreaterThan:
+		return v.push(v.nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterThanOrEqual:
+		return v.push(v.nativeBoolToBooleanObject(leftValue >= rightValue))
+	case code.OpLessThan:
+		return v.push(v.nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpLessThanOrEqual:
+		return v.push(v.nativeBoolToBooleanObject(leftValue <= rightValue))
 	default:
 		return fmt.Errorf("unknown operator: %d", op)
 	}
@@ -278,22 +750,41 @@ func (v *VM) executeBangOperator() error {
 }
 
 func (v *VM) executeMinusOperator() error {
+	operand := v.pop()
+	switch operand := operand.(type) {
+	case *object.Integer, *object.BigInt:
+		return v.push(object.NegateInteger(operand))
+	case *object.Float:
+		return v.push(&object.Float{Value: -operand.Value})
+	}
+	return fmt.Errorf("unsupported type for negation: %s", operand.Type())
+}
+
+func (v *VM) executeBitNotOperator() error {
 	operand := v.pop()
 	if operand.Type() != object.INTEGER {
-		return fmt.Errorf("unsupported type for negation: %s", operand.Type())
+		return fmt.Errorf("unsupported type for bitwise not: %s", operand.Type())
 	}
-	return v.push(&object.Integer{Value: -operand.(*object.Integer).Value})
+	return v.push(object.NotInteger(operand))
 }
 
-func (v *VM) buildArray(startIdx, endIdx int) object.Object {
+func (v *VM) buildArray(startIdx, endIdx int) (object.Object, error) {
+	if err := v.allocArray(endIdx - startIdx); err != nil {
+		return nil, err
+	}
+
 	elements := make([]object.Object, endIdx-startIdx)
 	for i := startIdx; i < endIdx; i++ {
 		elements[i-startIdx] = v.stack[i]
 	}
-	return &object.Array{Elements: elements}
+	return &object.Array{Elements: elements}, nil
 }
 
 func (v *VM) buildHash(startIdx, endIdx int) (object.Object, error) {
+	if err := v.allocHash((endIdx - startIdx) / 2); err != nil {
+		return nil, err
+	}
+
 	hashedPairs := make(map[object.HashKey]object.HashPair)
 	for i := startIdx; i < endIdx; i += 2 {
 		key := v.stack[i]
@@ -325,9 +816,45 @@ func (v *VM) executeIndexExpression(left, index object.Object) error {
 	return fmt.Errorf("invalid index. left: %s, index: %s", left.Type(), index.Type())
 }
 
+// executeSetIndex 配列は既存の要素のみ更新でき、ハッシュはキーがなければ追加する
+func (v *VM) executeSetIndex(left, index, value object.Object) error {
+	switch left := left.(type) {
+	case *object.Array:
+		if index.Type() != object.INTEGER {
+			break
+		}
+		// int64に収まらない添字は必ず範囲外になる
+		integer, ok := index.(*object.Integer)
+		if !ok || integer.Value < 0 || integer.Value >= int64(len(left.Elements)) {
+			return fmt.Errorf("index out of range: %s", index.Inspect())
+		}
+		left.Elements[integer.Value] = value
+		return v.push(value)
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+		hashKey := key.HashKey()
+		if _, ok := left.Pairs[hashKey]; !ok {
+			if err := v.allocHashPair(len(left.Pairs) + 1); err != nil {
+				return err
+			}
+		}
+		left.Pairs[hashKey] = object.HashPair{Key: index, Value: value}
+		return v.push(value)
+	}
+	return fmt.Errorf("invalid index. left: %s, index: %s", left.Type(), index.Type())
+}
+
 func (v *VM) executeArrayIndex(array, index object.Object) error {
 	arrayObject := array.(*object.Array)
-	i := index.(*object.Integer).Value
+	integer, ok := index.(*object.Integer)
+	if !ok {
+		// int64に収まらない添字は必ず範囲外になる
+		return v.push(Null)
+	}
+	i := integer.Value
 	max := int64(len(arrayObject.Elements) - 1)
 	if i < 0 || i > max {
 		return v.push(Null)
@@ -359,13 +886,54 @@ func isTruthy(obj object.Object) bool {
 	}
 }
 
+// newRuntimeError depthより深いフレームの呼び出し履歴をエラーに付加する
+func (v *VM) newRuntimeError(err error, depth int) error {
+	indexes := make([]int, 0, v.frameIndex-depth)
+	for i := v.frameIndex - 1; i >= depth; i-- {
+		if v.frames[i].ip >= 0 {
+			indexes = append(indexes, i)
+		}
+	}
+	omitted := 0
+	if len(indexes) > MaxTraceFrames {
+		omitted = len(indexes) - MaxTraceFrames
+		indexes = append(indexes[:MaxTraceFrames/2], indexes[len(indexes)-MaxTraceFrames/2:]...)
+	}
+
+	trace := make([]TraceFrame, 0, len(indexes))
+	for _, i := range indexes {
+		frame := v.frames[i]
+		pos, _ := frame.cl.Fn.SourceMap.Lookup(frame.ip)
+
+		name := frame.cl.Fn.Name
+		switch {
+		case i == 0:
+			name = "<main>"
+		case name == "":
+			name = "<anonymous>"
+		}
+		trace = append(trace, TraceFrame{Function: name, Pos: pos})
+	}
+	return &RuntimeError{Err: err, Trace: trace, Omitted: omitted}
+}
+
 func (v *VM) currentFrame() *Frame {
 	return v.frames[v.frameIndex-1]
 }
 
-func (v *VM) pushFrame(f *Frame) {
+func (v *VM) pushFrame(f *Frame) error {
+	if v.frameIndex >= len(v.frames) {
+		if v.frameIndex >= v.maxFrames {
+			return &StackOverflowError{Depth: v.frameIndex, MaxDepth: v.maxFrames}
+		}
+		frames := make([]*Frame, minInt(len(v.frames)*2, v.maxFrames))
+		copy(frames, v.frames)
+		v.frames = frames
+	}
+
 	v.frames[v.frameIndex] = f
 	v.frameIndex++
+	return nil
 }
 
 func (v *VM) popFrame() *Frame {
@@ -373,9 +941,28 @@ func (v *VM) popFrame() *Frame {
 	return v.frames[v.frameIndex]
 }
 
+// ensureStack スタックがsize個の値を積める大きさになるよう、上限まで広げる
+func (v *VM) ensureStack(size int) error {
+	if size <= len(v.stack) {
+		return nil
+	}
+	if size > v.maxStackSize {
+		return &StackOverflowError{Depth: v.frameIndex, MaxDepth: v.maxFrames, MaxStackSize: v.maxStackSize}
+	}
+
+	newSize := len(v.stack) * 2
+	for newSize < size {
+		newSize *= 2
+	}
+	stack := make([]object.Object, minInt(newSize, v.maxStackSize))
+	copy(stack, v.stack)
+	v.stack = stack
+	return nil
+}
+
 func (v *VM) push(obj object.Object) error {
-	if v.sp >= StackSize {
-		return errors.New("stack overflow")
+	if err := v.ensureStack(v.sp + 1); err != nil {
+		return err
 	}
 
 	v.stack[v.sp] = obj
@@ -389,3 +976,10 @@ func (v *VM) pop() object.Object {
 	v.sp--
 	return obj
 }
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -1,14 +1,20 @@
 package vm
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/karamaru-alpha/monkey/code"
 	"github.com/karamaru-alpha/monkey/compiler"
 	"github.com/karamaru-alpha/monkey/lexer"
 	"github.com/karamaru-alpha/monkey/object"
 	"github.com/karamaru-alpha/monkey/parser"
+	"github.com/karamaru-alpha/monkey/token"
 )
 
 func TestVM(t *testing.T) {
@@ -40,6 +46,80 @@ func TestVM(t *testing.T) {
 		{`[1, 2][0]`, 1},
 		{`{1: 2}[1]`, 2},
 		{`let hoge = fn() {1 + 2}; hoge()`, 3},
+		{`let hoge = fn() { }; hoge()`, nil},
+		{`let hoge = fn() { let a = 1; let b = 2; a + b }; hoge()`, 3},
+		{`let hoge = fn() { let a = 1; a }; let fuga = fn() { let a = 2; a }; hoge() + fuga()`, 3},
+		{`let g = 10; let hoge = fn() { let a = 1; g + a }; hoge() + hoge()`, 22},
+		{`let hoge = fn() { let a = 1; a }; let fuga = fn() { let b = 2; hoge() + b }; fuga()`, 3},
+		{`let multiple = fn(a, b) { return a * b; }; multiple(10, 2)`, 20},
+		{`fn(a, b) { return a / b; }(9, 3)`, 3},
+		{`let sum = fn(a, b) { let c = a + b; c }; sum(1, 2) + sum(3, 4)`, 10},
+		{`let sum = fn(a, b) { a + b }; let outer = fn() { sum(1, 2) + sum(3, 4) }; outer()`, 10},
+		{`let adder = fn(a) { fn(b) { a + b } }; let addTwo = adder(2); addTwo(3)`, 5},
+		{`let adder = fn(a, b) { let c = a + b; fn(d) { c + d } }; adder(1, 2)(8)`, 11},
+		{`let f = fn(a) { fn(b) { fn(c) { a + b + c } } }; f(1)(2)(3)`, 6},
+		{`let g = 1; let f = fn(a) { let b = 2; fn(c) { fn(d) { g + a + b + c + d } } }; f(3)(4)(5)`, 15},
+		{`let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(10)`, 55},
+		{`let wrapper = fn() { let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(10) }; wrapper()`, 55},
+		{`let wrapper = fn() { let countDown = fn(x) { if (x == 0) { return 0; } countDown(x - 1) }; countDown(3) }; wrapper()`, 0},
+		{`len([])`, 0},
+		{`len([1, 2])`, 2},
+		{`let arr = [1, 2, 3]; fn() { len(arr) }()`, 3},
+		{`puts(1)`, nil},
+		{`len(1)`, &object.Error{Message: "unsupported len."}},
+		{`len([], [])`, &object.Error{Message: "wrong number of argument. got=2, want=1"}},
+		{`1.5`, 1.5},
+		{`2e-3`, 0.002},
+		{`1.5 + 2`, 3.5},
+		{`3 - 0.5`, 2.5},
+		{`1.5 * 2`, 3.0},
+		{`1 / 4.0`, 0.25},
+		{`-2.5`, -2.5},
+		{`1.5 > 1`, true},
+		{`1 < 0.5`, false},
+		{`2 == 2.0`, true},
+		{`2.5 != 2.5`, false},
+		{`{1: "a"}[1.0]`, "a"},
+		{`int(2.9)`, 2},
+		{`int(-2.9)`, -2},
+		{`int("42")`, 42},
+		{`float(3)`, 3.0},
+		{`float("1.25")`, 1.25},
+		{`round(2.5)`, 3},
+		{`round(1.2345, 2)`, 1.23},
+		{`round(1234.5, -2)`, 1200.0},
+		{`round(1.5, 400)`, 1.5},
+		{`round(1e300, 10)`, 1e300},
+		{`round(123.0, -400)`, 0.0},
+		{`floor(-1.5)`, -2},
+		{`ceil(1.1)`, 2},
+		{`ceil(7)`, 7},
+		{`let floor = 3; floor + 1`, 4},
+		{`let f = fn() { let ceil = 2; ceil }; f() + ceil(0.5)`, 3},
+		{`int("x")`, &object.Error{Message: `cannot convert "x" to INTEGER`}},
+		{`int(float("inf"))`, &object.Error{Message: "cannot convert +Inf to INTEGER"}},
+		{`9223372036854775807 + 1`, "9223372036854775808"},
+		{`-9223372036854775807 - 2`, "-9223372036854775809"},
+		{`4294967296 * 4294967296`, "18446744073709551616"},
+		{`-(-9223372036854775807 - 1)`, "9223372036854775808"},
+		{`(-9223372036854775807 - 1) / -1`, "9223372036854775808"},
+		{`99999999999999999999 - 99999999999999999998`, 1},
+		{`let big = 18446744073709551616; big / 4294967296`, 4294967296},
+		{`18446744073709551616 > 9223372036854775807`, true},
+		{`18446744073709551616 == 18446744073709551616`, true},
+		{`{18446744073709551616: "big", 1: "one"}[9223372036854775807 * 2 + 2]`, "big"},
+		{`{1: "one"}[100000000000000000000 - 99999999999999999999]`, "one"},
+		{`{1e20: "f"}[100000000000000000000]`, "f"},
+		{`18446744073709551616 + 0.5`, 18446744073709551616.5},
+		{`int(1e20)`, "100000000000000000000"},
+		{`int("123456789012345678901234567890")`, "123456789012345678901234567890"},
+		{`[1][18446744073709551616]`, nil},
+		{`round("a")`, &object.Error{Message: "unsupported round. got=STRING"}},
+		{`len("こんにちは")`, 15},
+		{`runeLen("こんにちは")`, 5},
+		{`runeLen("")`, 0},
+		{`runeLen([])`, &object.Error{Message: "unsupported runeLen. got=ARRAY"}},
+		{`let 名前 = "モンキー"; let x2 = 2; 名前 + "!"`, "モンキー!"},
 	} {
 		program := parser.New(lexer.New(tt.input)).ParseProgram()
 
@@ -53,7 +133,15 @@ func TestVM(t *testing.T) {
 		switch expected := tt.expected.(type) {
 		case int:
 			assert.Equal(t, int64(expected), stackElem.(*object.Integer).Value)
+		case float64:
+			assert.Equal(t, expected, stackElem.(*object.Float).Value)
 		case string:
+			// 多倍長整数はInspectで比較する
+			if stackElem.Type() == object.INTEGER {
+				assert.Equal(t, expected, stackElem.Inspect())
+				assert.IsType(t, &object.BigInt{}, stackElem)
+				continue
+			}
 			assert.Equal(t, expected, stackElem.(*object.String).Value)
 		case bool:
 			assert.Equal(t, expected, stackElem.(*object.Boolean).Value)
@@ -68,6 +156,400 @@ func TestVM(t *testing.T) {
 			for _, pair := range stackElem.(*object.Hash).Pairs {
 				assert.Equal(t, expected[int(pair.Key.(*object.Integer).Value)], int(pair.Value.(*object.Integer).Value))
 			}
+		case *object.Error:
+			assert.Equal(t, expected, stackElem)
+		}
+	}
+}
+
+func TestVM_CallingFunctionsWithWrongArguments(t *testing.T) {
+	for _, tt := range []struct {
+		input    string
+		expected string
+	}{
+		{`fn() { 1 }(1)`, "wrong number of arguments: want=0, got=1"},
+		{`fn(a) { a }()`, "wrong number of arguments: want=1, got=0"},
+		{`fn(a, b) { a + b }(1)`, "wrong number of arguments: want=2, got=1"},
+		{`1(1)`, "calling non-function"},
+	} {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+
+		c := compiler.New()
+		assert.NoError(t, c.Compile(program))
+
+		vm := New(c.Bytecode())
+		assert.EqualError(t, errors.Unwrap(vm.Run()), tt.expected)
+	}
+}
+
+func TestVM_UninitializedVariable(t *testing.T) {
+	testInspect(t, []inspectTest{
+		{"if (false) { let y = 1; }; y", "global variable is not initialized"},
+		{"fn() { if (false) { let x = 1; }; x + 1 }()", "local variable is not initialized"},
+		{"fn() { if (false) { let x = 1; }; x }()", "local variable is not initialized"},
+		{"let f = fn() { if (false) { let x = 1; }; fn() { x } }; f()()", "free variable is not initialized"},
+		{"fn() { if (false) { let x = 1; }; let g = fn() { x }; x }()", "local variable is not initialized"},
+		{"fn() { if (true) { let x = 1; }; x }()", "1"},
+	})
+}
+
+func TestVM_Call(t *testing.T) {
+	input := `
+let counter = fn(start) { let step = 2; fn(n) { start + step * n } };
+let fromTen = counter(10);
+let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };
+`
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	symbolTable := compiler.NewSymbolTable()
+	c := compiler.NewWithState(symbolTable, []object.Object{})
+	assert.NoError(t, c.Compile(program))
+
+	vm := New(c.Bytecode())
+	assert.NoError(t, vm.Run())
+
+	for _, tt := range []struct {
+		name     string
+		args     []object.Object
+		expected int64
+	}{
+		{"fromTen", []object.Object{&object.Integer{Value: 3}}, 16},
+		{"fib", []object.Object{&object.Integer{Value: 15}}, 610},
+	} {
+		fn, err := vm.LookupGlobal(symbolTable, tt.name)
+		assert.NoError(t, err)
+
+		result, err := vm.Call(fn, tt.args...)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expected, result.(*object.Integer).Value)
+	}
+
+	// エラーが起きてもVMは呼び出し前の状態に戻る
+	fib, err := vm.LookupGlobal(symbolTable, "fib")
+	assert.NoError(t, err)
+	_, err = vm.Call(fib, &object.String{Value: "a"})
+	assert.Error(t, err)
+	result, err := vm.Call(fib, &object.Integer{Value: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(55), result.(*object.Integer).Value)
+
+	_, err = vm.LookupGlobal(symbolTable, "undefined")
+	assert.EqualError(t, err, "undefined global variable undefined")
+}
+
+func TestVM_RunContext(t *testing.T) {
+	input := `let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(50)`
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	c := compiler.New()
+	assert.NoError(t, c.Compile(program))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := New(c.Bytecode()).RunContext(ctx)
+	assert.ErrorIs(t, err, object.ErrCanceled)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, New(c.Bytecode()).RunContext(canceled), context.Canceled)
+}
+
+func TestVM_CallContext(t *testing.T) {
+	type ctxKey struct{}
+	outer := context.WithValue(context.Background(), ctxKey{}, "outer")
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var vm *VM
+	callback := &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		// キャンセル済みのctxでは呼び出さない
+		_, err := vm.CallContext(canceled, args[0], &object.Integer{Value: 1})
+		assert.ErrorIs(t, err, object.ErrCanceled)
+
+		result, err := vm.CallContext(context.WithValue(context.Background(), ctxKey{}, "inner"), args[0], &object.Integer{Value: 2})
+		assert.NoError(t, err)
+		// 呼び出し元のctxに戻っている
+		assert.Equal(t, "outer", vm.ctx.Value(ctxKey{}))
+		return result
+	}}
+
+	program := parser.New(lexer.New(`let f = fn(x) { x * 2 }; callback(f)`)).ParseProgram()
+	symbolTable := compiler.NewSymbolTable()
+	symbolTable.DefineBuiltin(0, "callback")
+	c := compiler.NewWithState(symbolTable, []object.Object{})
+	assert.NoError(t, c.Compile(program))
+
+	vm = New(c.Bytecode(), WithBuiltins([]*object.Builtin{callback}))
+	assert.NoError(t, vm.RunContext(outer))
+	assert.Equal(t, "4", vm.LastPoppedStackElem().Inspect())
+	assert.Equal(t, "outer", vm.ctx.Value(ctxKey{}))
+}
+
+func TestVM_Gas(t *testing.T) {
+	program := parser.New(lexer.New(`let f = fn(a) { a + 1 }; f(1)`)).ParseProgram()
+	c := compiler.New()
+	assert.NoError(t, c.Compile(program))
+
+	// OpClosure(3) OpSetGlobal(1) OpGetGlobal(1) OpConstant(1) OpCall(5) OpGetLocal(1) OpConstant(1) OpAdd(1) OpReturn(1) OpPop(1)
+	vm := New(c.Bytecode())
+	assert.NoError(t, vm.Run())
+	assert.Equal(t, uint64(16), vm.GasUsed())
+
+	vm = New(c.Bytecode(), WithGasLimit(16))
+	assert.NoError(t, vm.Run())
+
+	vm = New(c.Bytecode(), WithGasLimit(10))
+	err := vm.Run()
+	assert.ErrorIs(t, err, ErrOutOfGas)
+	assert.Equal(t, &OutOfGasError{Limit: 10, Used: 6}, errors.Unwrap(err))
+	assert.Equal(t, uint64(6), vm.GasUsed())
+
+	vm = New(c.Bytecode(), WithCostTable(code.CostTable{}))
+	assert.NoError(t, vm.Run())
+	assert.Equal(t, uint64(10), vm.GasUsed())
+
+	// 消費済みのgasも上限に含める
+	vm = New(c.Bytecode(), WithGasLimit(20), WithGasUsed(10))
+	err = vm.Run()
+	assert.Equal(t, &OutOfGasError{Limit: 20, Used: 16}, errors.Unwrap(err))
+}
+
+func TestVM_StackOverflow(t *testing.T) {
+	program := parser.New(lexer.New(`let f = fn() { f() }; f()`)).ParseProgram()
+	c := compiler.New()
+	assert.NoError(t, c.Compile(program))
+
+	err := New(c.Bytecode()).Run()
+	assert.ErrorIs(t, err, ErrStackOverflow)
+	assert.EqualError(t, errors.Unwrap(err), "stack overflow: maximum call depth 1024 exceeded")
+	assert.Equal(t, &StackOverflowError{Depth: 1024, MaxDepth: 1024}, errors.Unwrap(err))
+
+	err = New(c.Bytecode(), WithMaxFrames(10)).Run()
+	assert.EqualError(t, errors.Unwrap(err), "stack overflow: maximum call depth 10 exceeded")
+
+	// 1回の呼び出しで関数と引数の2つを積む
+	program = parser.New(lexer.New(`let f = fn(n) { if (n == 0) { return 0; } f(n - 1) }; f(3000)`)).ParseProgram()
+	c = compiler.New()
+	assert.NoError(t, c.Compile(program))
+
+	err = New(c.Bytecode(), WithMaxFrames(5000)).Run()
+	assert.ErrorIs(t, err, ErrStackOverflow)
+	assert.EqualError(t, errors.Unwrap(err), "stack overflow: maximum stack size 2048 exceeded at call depth 1024")
+
+	vm := New(c.Bytecode(), WithMaxFrames(5000), WithMaxStackSize(10000))
+	assert.NoError(t, vm.Run())
+	assert.Equal(t, int64(0), vm.LastPoppedStackElem().(*object.Integer).Value)
+}
+
+func TestVM_RuntimeErrorTrace(t *testing.T) {
+	input := `let add = fn(a, b) {
+	a + b
+};
+let apply = fn(f) { f(1, true) };
+apply(add);`
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	c := compiler.New()
+	assert.NoError(t, c.Compile(program))
+
+	err := New(c.Bytecode()).Run()
+	assert.Equal(t, &RuntimeError{
+		Err: errors.New("unsupported types for binary operation: INTEGER BOOLEAN"),
+		Trace: []TraceFrame{
+			{Function: "add", Pos: token.Position{Offset: 22, Line: 2, Column: 2}},
+			{Function: "apply", Pos: token.Position{Offset: 51, Line: 4, Column: 21}},
+			{Function: "<main>", Pos: token.Position{Offset: 65, Line: 5, Column: 1}},
+		},
+	}, err)
+	assert.EqualError(t, err, `unsupported types for binary operation: INTEGER BOOLEAN
+	at add (2:2)
+	at apply (4:21)
+	at <main> (5:1)`)
+
+	program = parser.New(lexer.New(`fn() { 1() }()`)).ParseProgram()
+	c = compiler.New()
+	assert.NoError(t, c.Compile(program))
+	assert.EqualError(t, New(c.Bytecode()).Run(), `calling non-function
+	at <anonymous> (1:8)
+	at <main> (1:1)`)
+}
+
+func TestVM_RuntimeErrorTraceOmitted(t *testing.T) {
+	program := parser.New(lexer.New(`let f = fn() { f() }; f()`)).ParseProgram()
+	c := compiler.New()
+	assert.NoError(t, c.Compile(program))
+
+	err := New(c.Bytecode()).Run()
+	var runtimeErr *RuntimeError
+	assert.ErrorAs(t, err, &runtimeErr)
+	assert.Len(t, runtimeErr.Trace, MaxTraceFrames)
+	assert.Equal(t, 1024-MaxTraceFrames, runtimeErr.Omitted)
+
+	expected := "stack overflow: maximum call depth 1024 exceeded" +
+		strings.Repeat("\n\tat f (1:16)", MaxTraceFrames/2) +
+		"\n\t... 1004 more frames" +
+		strings.Repeat("\n\tat f (1:16)", MaxTraceFrames/2-1) +
+		"\n\tat <main> (1:23)"
+	assert.EqualError(t, err, expected)
+}
+
+// TestVM_Arithmetic 入力と結果はevaluator.TestEval_Arithmeticと揃えている
+func TestVM_Arithmetic(t *testing.T) {
+	testInspect(t, []inspectTest{
+		{"7 / 2", "3"},
+		{"-7 / 2", "-4"},
+		{"7 / -2", "-4"},
+		{"-7 / -2", "3"},
+		{"7 % 3", "1"},
+		{"-7 % 3", "2"},
+		{"7 % -3", "-2"},
+		{"-7 % -3", "-1"},
+		{"7 / 2.0", "3.5"},
+		{"-7.5 % 2", "0.5"},
+		{"7.5 % -2", "-0.5"},
+		{"2 ** 10", "1024"},
+		{"2 ** 3 ** 2", "512"},
+		{"-2 ** 2", "-4"},
+		{"(-2) ** 3", "-8"},
+		{"2 ** -2", "0.25"},
+		{"9 ** 0.5", "3.0"},
+		{"2 ** 64", "18446744073709551616"},
+		{"18446744073709551616 % 7", "2"},
+		{"-18446744073709551616 / 3", "-6148914691236517206"},
+		{"let x = 1 << 8000000; x * x", "product too large: 16000002 bits"},
+		{"1 / 0", "division by zero"},
+		{"1 % 0", "division by zero"},
+		{"1.5 / 0", "division by zero"},
+		{"1 % 0.0", "division by zero"},
+		{"18446744073709551616 / 0", "division by zero"},
+		{"0 ** -1", "division by zero"},
+		{"0.0 ** -1", "division by zero"},
+		{"fn(x) { x / 0 }(1)", "division by zero"},
+	})
+}
+
+type inspectTest struct {
+	input    string
+	expected string // 結果のInspect。エラーの場合はメッセージ
+}
+
+func testInspect(t *testing.T, tests []inspectTest) {
+	t.Helper()
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+
+		c := compiler.New()
+		assert.NoError(t, c.Compile(program), tt.input)
+
+		vm := New(c.Bytecode())
+		if err := vm.Run(); err != nil {
+			assert.EqualError(t, errors.Unwrap(err), tt.expected, tt.input)
+			continue
 		}
+		assert.Equal(t, tt.expected, vm.LastPoppedStackElem().Inspect(), tt.input)
 	}
 }
+
+// TestVM_Comparison 入力と結果はevaluator.TestEval_Comparisonと揃えている
+func TestVM_Comparison(t *testing.T) {
+	testInspect(t, []inspectTest{
+		{"1 <= 1", "true"},
+		{"2 <= 1", "false"},
+		{"1 >= 1", "true"},
+		{"0 >= 1", "false"},
+		{"1.5 <= 1", "false"},
+		{"1 >= 0.5", "true"},
+		{"18446744073709551616 >= 9223372036854775807", "true"},
+		{`"a" < "b"`, "true"},
+		{`"b" <= "a"`, "false"},
+		{`"abc" > "abd"`, "false"},
+		{`"abc" >= "ab"`, "true"},
+		{`"a" < "ä"`, "true"},
+		{`"a" == "a"`, "true"},
+		{`"a" != "a"`, "false"},
+		{"true && true", "true"},
+		{"1 && 2", "true"},
+		{"true && if (false) { 1 }", "false"},
+		{"false || false", "false"},
+		{"false || 0", "true"},
+		{"1 < 2 && 2 < 3", "true"},
+		{"let x = 5; x >= 0 && x <= 10", "true"},
+		{"fn(n) { n > 0 && n % 2 == 0 }(3)", "false"},
+		{"false && 1 / 0", "false"},
+		{"true || 1 / 0", "true"},
+		{"true && 1 / 0", "division by zero"},
+		{"false || 1 / 0", "division by zero"},
+		// 左辺から評価する
+		{"let x = 1; (x = 2) <= x", "true"},
+		{"let x = 1; x < (x = 2)", "true"},
+		{"let a = [0]; (a[0] = 1) < (a[0] = 2); a[0]", "2"},
+		{"let a = [0]; (a[0] = 2) <= (a[0] = 1); a[0]", "1"},
+		{"1 < 1 / 0", "division by zero"},
+	})
+}
+
+// TestVM_Bitwise エラーメッセージ以外はevaluator.TestEval_Bitwiseと揃えている
+func TestVM_Bitwise(t *testing.T) {
+	testInspect(t, []inspectTest{
+		{"6 & 3", "2"},
+		{"6 | 3", "7"},
+		{"6 ^ 3", "5"},
+		{"~5", "-6"},
+		{"~-1", "0"},
+		{"-1 & 255", "255"},
+		{"1 << 4", "16"},
+		{"256 >> 4", "16"},
+		{"-16 >> 2", "-4"},
+		{"1 << 2 + 1", "8"},
+		{"1 << 64", "18446744073709551616"},
+		{"(1 << 64) >> 63", "2"},
+		{"~(1 << 64)", "-18446744073709551617"},
+		{"let READ = 1; let WRITE = 2; let perm = READ | WRITE; perm & WRITE != 0 && perm & 4 == 0", "true"},
+		{"1 << -1", "negative shift count: -1"},
+		{"1 >> -3", "negative shift count: -3"},
+		{"1 << 9223372036854775807", "shift count too large: 9223372036854775807"},
+		{"1 >> 100000000000000000000", "0"},
+		{"-1 >> 100000000000000000000", "-1"},
+		{"0 << 100000000000000000000", "0"},
+		{"1 << 100000000000000000000", "shift count too large: 100000000000000000000"},
+		{"~true", "unsupported type for bitwise not: BOOLEAN"},
+		{"1.5 & 1", "unsupported types for binary operation: FLOAT INTEGER"},
+	})
+}
+
+func TestVM_Assign(t *testing.T) {
+	testInspect(t, []inspectTest{
+		{"let x = 1; x = x + 1; x", "2"},
+		{"let x = 1; let y = x = 5; x + y", "10"},
+		{"let a = 1; let b = 2; a = b = 3; a + b", "6"},
+		{"let f = fn() { let x = 1; x = x + 10; x }; f()", "11"},
+		{"let f = fn(n) { n = n * 2; n }; f(21)", "42"},
+		{"let g = 1; let f = fn() { g = g + 1 }; f(); f(); g", "3"},
+		{"let counter = fn() { let c = 0; fn() { c = c + 1 } }; let next = counter(); next(); next(); next()", "3"},
+		{"let counter = fn() { let c = 0; fn() { c = c + 1 } }; let a = counter(); let b = counter(); a(); a(); b()", "1"},
+		{"let counter = fn() { let c = 0; fn() { c = c + 1 } }; let a = counter(); a(); let b = counter(); b(); a()", "2"},
+		{"let f = fn() { let c = 0; let inc = fn() { c = c + 1 }; inc(); inc(); c }; f()", "2"},
+		{"let f = fn() { let c = 0; let get = fn() { c }; c = 5; get() }; f()", "5"},
+		{"let pair = fn() { let v = 0; [fn(x) { v = x }, fn() { v }] }; let p = pair(); p[0](7); p[1]()", "7"},
+		{"let f = fn() { let c = 0; fn() { fn() { c = c + 1 } } }; let g = f(); g()(); g()()", "2"},
+		{"let f = fn() { f = 5; 1 }; f(); f", "5"},
+		{"let f = fn(n) { if (n == 0) { return 0; } f(n - 1) }; let g = f; f = fn(n) { 100 }; g(1)", "100"},
+		{"let w = fn() { let f = fn(n) { if (n == 0) { return 0; } f(n - 1) }; let g = f; f = fn(n) { 100 }; g(1) }; w()", "100"},
+		{"let arr = [1, 2, 3]; arr[1] = 20; arr", "[1, 20, 3]"},
+		{"let arr = [1, 2]; let alias = arr; alias[0] = 5; arr[0]", "5"},
+		{"let arr = [1]; arr[0] = arr[0] + 1", "2"},
+		{"let m = [[1], [2]]; m[1][0] = 9; m[1][0]", "9"},
+		{`let h = {"a": 1}; h["a"] = 2; h["b"] = 3; h["a"] + h["b"]`, "5"},
+		{`let h = {}; h[1] = "one"; h[1.0]`, "one"},
+		{"let a = [0]; a[0] = a; a", "[[...]]"},
+		{"let a = [1]; let b = [a, a]; a[0] = b; b", "[[[...]], [[...]]]"},
+		{`let h = {}; h["self"] = h; h`, "{self:{...}}"},
+		{`let a = [0]; a[0] = {"a": a}; a`, "[{a:[...]}]"},
+		{"let arr = [1]; arr[1] = 2", "index out of range: 1"},
+		{"let arr = [1]; arr[-1] = 2", "index out of range: -1"},
+		{"let arr = [1]; arr[18446744073709551616] = 2", "index out of range: 18446744073709551616"},
+		{`let h = {}; h[[]] = 1`, "unusable as hash key: ARRAY"},
+	})
+}